@@ -0,0 +1,97 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+)
+
+const (
+	// Number of undelivered events queued for each client
+	subscriberQueueSize = 256
+)
+
+// subscriber is a single client of the broadcaster. Its events channel
+// is closed if the client falls too far behind to keep up.
+type subscriber struct {
+	events chan webSockResult
+}
+
+// broadcaster numbers every published event and delivers it to all of
+// its subscribers. The most recent events are kept in a ring buffer so
+// that a client that reconnects can catch up on what it missed.
+type broadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[*subscriber]bool
+	seq         uint64
+	history     []webSockResult
+}
+
+func newBroadcaster(historySize int) *broadcaster {
+	return &broadcaster{subscribers: make(map[*subscriber]bool),
+		history: make([]webSockResult, historySize)}
+}
+
+// subscribe registers a new subscriber along with the sequence number of
+// the last published event. If since is non-zero and every event after it
+// is still in the history then those events are queued for the subscriber
+// and replayed is true. Otherwise the subscriber must resync its state.
+func (b *broadcaster) subscribe(since uint64) (sub *subscriber, seq uint64, replayed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var missed []webSockResult
+	if since != 0 && since <= b.seq && b.seq-since <= uint64(len(b.history)) {
+		for s := since + 1; s <= b.seq; s++ {
+			missed = append(missed, b.history[s%uint64(len(b.history))])
+		}
+		replayed = true
+	}
+
+	sub = &subscriber{events: make(chan webSockResult, subscriberQueueSize+len(missed))}
+	for _, event := range missed {
+		sub.events <- event
+	}
+
+	b.subscribers[sub] = true
+	return sub, b.seq, replayed
+}
+
+func (b *broadcaster) unsubscribe(sub *subscriber) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.subscribers[sub] {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (b *broadcaster) lastSeq() uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.seq
+}
+
+func (b *broadcaster) publish(event webSockResult) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.seq++
+	event.Seq = b.seq
+	b.history[b.seq%uint64(len(b.history))] = event
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			// This client can't keep up. Cut it loose rather than stall
+			//  everyone else, it will resync when it reconnects.
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
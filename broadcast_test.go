@@ -0,0 +1,75 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var subscribeTests = []struct {
+	history   int
+	published int
+	since     uint64
+	replayed  bool
+	seqs      []uint64
+}{
+	// A new client always resyncs
+	{4, 0, 0, false, nil},
+	{4, 3, 0, false, nil},
+	// Nothing was missed
+	{4, 3, 3, true, nil},
+	{4, 3, 2, true, []uint64{3}},
+	{4, 3, 1, true, []uint64{2, 3}},
+	// The ring buffer has wrapped around
+	{4, 10, 6, true, []uint64{7, 8, 9, 10}},
+	{4, 10, 8, true, []uint64{9, 10}},
+	// Older than the history
+	{4, 10, 5, false, nil},
+	{4, 10, 1, false, nil},
+	// From a previous session with more events than this one
+	{4, 3, 7, false, nil},
+}
+
+func TestSubscribe(t *testing.T) {
+	for _, tt := range subscribeTests {
+		b := newBroadcaster(tt.history)
+		for i := 0; i < tt.published; i++ {
+			b.publish(webSockResult{Type: "test"})
+		}
+
+		sub, seq, replayed := b.subscribe(tt.since)
+
+		var seqs []uint64
+		for len(sub.events) > 0 {
+			seqs = append(seqs, (<-sub.events).Seq)
+		}
+
+		if seq != uint64(tt.published) || replayed != tt.replayed || !reflect.DeepEqual(seqs, tt.seqs) {
+			t.Errorf("history %d, published %d, subscribe(%d) = %d, %v, replaying %v; want %d, %v, replaying %v",
+				tt.history, tt.published, tt.since, seq, replayed, seqs, tt.published, tt.replayed, tt.seqs)
+		}
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	b := newBroadcaster(4)
+	sub, _, _ := b.subscribe(0)
+
+	for i := 0; i <= subscriberQueueSize; i++ {
+		b.publish(webSockResult{Type: "test"})
+	}
+
+	n := 0
+	for range sub.events {
+		n++
+	}
+	if n != subscriberQueueSize {
+		t.Errorf("got %d events before the subscriber was dropped, want %d", n, subscriberQueueSize)
+	}
+
+	// Unsubscribing after being dropped must not close the channel again
+	b.unsubscribe(sub)
+}
@@ -0,0 +1,112 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// builder compiles Go packages with optimizations and inlining disabled
+// so that they can be debugged. Binaries are written to a temporary
+// directory owned by the builder rather than anywhere in the GOPATH.
+type builder struct {
+	tags    string
+	race    bool
+	ldflags string
+
+	tempDir string
+}
+
+// buildFlags are the flags shared by every go command that the builder runs.
+func (b *builder) buildFlags() []string {
+	args := []string{"-gcflags=all=-N -l"}
+	if b.tags != "" {
+		args = append(args, "-tags", b.tags)
+	}
+	if b.race {
+		args = append(args, "-race")
+	}
+	if b.ldflags != "" {
+		args = append(args, "-ldflags", b.ldflags)
+	}
+	return args
+}
+
+// outputPath reserves a path in the temporary directory for a binary.
+func (b *builder) outputPath(name string) (string, error) {
+	if b.tempDir == "" {
+		dir, err := ioutil.TempDir("", "godbg")
+		if err != nil {
+			return "", err
+		}
+		b.tempDir = dir
+	}
+
+	if runtime.GOOS == "windows" {
+		name = name + ".exe"
+	}
+	return filepath.Join(b.tempDir, "bin", name), nil
+}
+
+// packageDir finds the source directory of a package pattern, which
+// works for both module and GOPATH mode.
+func packageDir(pkg string) (string, error) {
+	// Only stdout has the directories, the go command also writes progress
+	//  like downloads to stderr
+	cmd := exec.Command("go", "list", "-f", "{{.Dir}}", pkg)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", errors.New(string(exitErr.Stderr))
+		}
+		return "", err
+	}
+
+	dirs := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(dirs) != 1 || dirs[0] == "" {
+		return "", errors.New("Expected exactly one package for " + pkg)
+	}
+	return dirs[0], nil
+}
+
+// build compiles the main package named by pkg (such as "." or an import
+// path) and returns the path of the binary and the package's source
+// directory.
+func (b *builder) build(pkg string) (execPath string, pkgDir string, err error) {
+	pkgDir, err = packageDir(pkg)
+	if err != nil {
+		return "", "", err
+	}
+
+	execPath, err = b.outputPath(filepath.Base(pkgDir))
+	if err != nil {
+		return "", "", err
+	}
+
+	args := append([]string{"build"}, b.buildFlags()...)
+	args = append(args, "-o", execPath, pkg)
+
+	cmd := exec.Command("go", args...)
+	msg, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", "", errors.New(string(msg))
+	}
+
+	return execPath, pkgDir, nil
+}
+
+// cleanup removes anything that the builder has written.
+func (b *builder) cleanup() {
+	if b.tempDir != "" {
+		os.RemoveAll(b.tempDir)
+		b.tempDir = ""
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// The web bundles are compiled into the binary so that godbg is
+// self-contained no matter how it was installed.
+//
+//go:embed bundles/*/web
+var embeddedBundles embed.FS
+
+// bundleFileSystem chains together the web directories of all of the
+// bundles. If overlayDir is set then the bundles found there take
+// precedence over the embedded ones, which is handy when working on
+// the UI.
+func bundleFileSystem(overlayDir string) (http.FileSystem, error) {
+	bundleFileSystems := []http.FileSystem{}
+
+	if overlayDir != "" {
+		file, err := os.Open(overlayDir)
+		if err != nil {
+			return nil, err
+		}
+		bundleNames, err := file.Readdirnames(-1)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, bundleName := range bundleNames {
+			bundleFileSystems = append(bundleFileSystems, http.Dir(filepath.Join(overlayDir, bundleName, "web")))
+		}
+	}
+
+	bundles, err := embeddedBundles.ReadDir("bundles")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bundle := range bundles {
+		web, err := fs.Sub(embeddedBundles, path.Join("bundles", bundle.Name(), "web"))
+		if err != nil {
+			return nil, err
+		}
+		bundleFileSystems = append(bundleFileSystems, http.FS(web))
+	}
+
+	return chainedFileSystem{fs: bundleFileSystems}, nil
+}
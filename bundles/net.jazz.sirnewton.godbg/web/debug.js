@@ -11,6 +11,11 @@ define(['orion/xhr'], function(xhr) {
 		window.alert("ERROR: "+e.responseText);
 	};
 
+	// Text from the program or the debugger is escaped before it goes into markup
+	var escapeHtml = function(text) {
+		return String(text).replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;").replace(/"/g, "&quot;");
+	};
+	
 	// Simplified xhr call
 	var myXhr = function(method, path, data) {
 		if (!data) {
@@ -52,6 +57,11 @@ define(['orion/xhr'], function(xhr) {
 			this.nextButton = document.getElementById("next");
 			this.stepButton = document.getElementById("step");
 			this.continueButton = document.getElementById("continue");
+			this.signalButton = document.getElementById("signal");
+			this.nextiButton = document.getElementById("nexti");
+			this.stepiButton = document.getElementById("stepi");
+			this.finishButton = document.getElementById("finish");
+			this.returnButton = document.getElementById("return");
 			
 			// Everything starts off disabled until we are on a stopped thread
 			this.disable();
@@ -59,6 +69,43 @@ define(['orion/xhr'], function(xhr) {
 			clickCallback(this, this.nextButton, "POST", "/handle/exec/next");
 			clickCallback(this, this.stepButton, "POST", "/handle/exec/step");
 			clickCallback(this, this.continueButton, "POST", "/handle/exec/continue");
+			clickCallback(this, this.nextiButton, "POST", "/handle/exec/nexti");
+			clickCallback(this, this.stepiButton, "POST", "/handle/exec/stepi");
+			clickCallback(this, this.finishButton, "POST", "/handle/exec/finish");
+			
+			// Returning early doesn't stop the program again so refresh the stack
+			clickCallback(this, this.returnButton, "POST", "/handle/exec/return", {}, function(result) {
+				allThreadsWidget.handleAllThreadsStopped(allThreadsWidget.selectedThread);
+			});
+			
+			// Double click a source line to run to it, with the control key to jump to it
+			document.getElementById("fileArea").addEventListener("dblclick", myCallback(this, function(e) {
+				var line = e.target.getAttribute("data-line");
+				var file = document.getElementById("fileArea").getAttribute("data-file");
+				
+				if (!this.isEnabled() || !line || !file) {
+					return;
+				}
+				
+				var path = "/handle/exec/until";
+				if (e.ctrlKey || e.metaKey) {
+					path = "/handle/exec/jump";
+				}
+				
+				myXhr("POST", path, {
+					Location: file + ":" + line
+				}).then(function(r) {}, handleXhrError);
+			}));
+			
+			this.signalButton.addEventListener("click", myCallback(this, function(e) {
+				var signal = window.prompt("Resume the program with the signal", "SIGQUIT");
+				
+				if (signal) {
+					myXhr("POST", "/handle/exec/signal", {
+						Signal: signal
+					}).then(function(r) {}, handleXhrError);
+				}
+			}));
 			
 			document.addEventListener("keydown", myCallback(this, function(e) {
 				if (this.isEnabled() && e.target.nodeName.toLowerCase() !== "input") {
@@ -71,21 +118,41 @@ define(['orion/xhr'], function(xhr) {
 					// 'c' - Continue
 					} else if (e.keyCode === 67) {
 						myXhr("POST", "/handle/exec/continue").then(function(r) {}, handleXhrError);
+					// 'f' - Finish
+					} else if (e.keyCode === 70) {
+						myXhr("POST", "/handle/exec/finish").then(function(r) {}, handleXhrError);
 					}
 				}
 			}));
 		},
 		
+		// Read-only sessions (e.g. core dumps) can't be executed
+		readOnly: false,
+		
 		enable: function() {
+			if (this.readOnly) {
+				return;
+			}
+			
 			this.nextButton.disabled = false;
 			this.stepButton.disabled = false;
 			this.continueButton.disabled = false;
+			this.signalButton.disabled = false;
+			this.nextiButton.disabled = false;
+			this.stepiButton.disabled = false;
+			this.finishButton.disabled = false;
+			this.returnButton.disabled = false;
 		},
 		
 		disable: function() {
 			this.nextButton.disabled = true;
 			this.stepButton.disabled = true;
 			this.continueButton.disabled = true;
+			this.signalButton.disabled = true;
+			this.nextiButton.disabled = true;
+			this.stepiButton.disabled = true;
+			this.finishButton.disabled = true;
+			this.returnButton.disabled = true;
 		},
 		
 		isEnabled: function() {
@@ -101,11 +168,181 @@ define(['orion/xhr'], function(xhr) {
 	var exitButton = document.getElementById("exit");
 	clickCallback(null, exitButton, "POST", "/handle/gdb/exit");
 	
+	// Shows the machine code of the selected frame's function in place of
+	//  its source, with the source lines in between
+	var disassemblyWidget = {
+		button: document.getElementById("showDisassembly"),
+		showing: false,
+		frame: null,
+		
+		init: function() {
+			this.button.addEventListener("click", myCallback(this, function(e) {
+				this.showing = !this.showing;
+				this.button.innerHTML = this.showing ? "Show Source" : "Show Disassembly";
+				
+				if (this.frame) {
+					this.frame.select();
+				}
+			}));
+		},
+		
+		show: function(frame) {
+			this.frame = frame;
+			
+			myXhr("POST", "/handle/disassemble", {
+				File: frame.frame.fullname,
+				Line: parseInt(frame.frame.line, 10),
+				Source: true
+			}).then(myCallback(this, function(result) {
+				var lines = JSON.parse(result.response).asm_insns;
+				var pc = parseInt(frame.frame.addr, 16);
+				var html = "";
+				
+				for (var idx = 0; idx < lines.length; idx++) {
+					var line = lines[idx];
+					html = html + '<pre style="margin-bottom: 0px; margin-top: 0px; font-weight: bold;">' +
+						escapeHtml(line.file) + ":" + line.line + "</pre>";
+					
+					for (var insnIdx = 0; insnIdx < line.line_asm_insn.length; insnIdx++) {
+						var insn = line.line_asm_insn[insnIdx];
+						
+						html = html + "<pre";
+						if (parseInt(insn.address, 16) === pc) {
+							html = html + ' id="scrolltoLine" style="background-color: yellow; margin-bottom: 0px; margin-top: 0px;"';
+						} else {
+							html = html + ' style="margin-bottom: 0px; margin-top: 0px;"';
+						}
+						html = html + ">    " + insn.address + " &lt;+" + insn.offset + "&gt;: " +
+							escapeHtml(insn.inst) + "</pre>";
+					}
+				}
+				
+				document.getElementById("fileArea").innerHTML = html;
+				document.getElementById("fileArea").removeAttribute("data-file");
+				document.getElementById("filePath").textContent = frame.frame.func;
+				
+				var current = document.getElementById("scrolltoLine");
+				if (current) {
+					current.scrollIntoView(true);
+				}
+			}), function(error) {
+				document.getElementById("fileArea").innerHTML = "";
+				document.getElementById("filePath").innerHTML = "";
+			});
+		}
+	};
+	
+	disassemblyWidget.init();
+	
+	// When debugging a test binary offer to (re)run any one of its tests
+	var testsWidget = {
+		testsSelect: document.getElementById("tests"),
+		debugTestButton: document.getElementById("debugTest"),
+		
+		init: function() {
+			myXhr("POST", "/handle/test/list", {
+			}).then(myCallback(this, function(result) {
+				var tests = JSON.parse(result.response).Tests;
+				
+				for (var idx = 0; idx < tests.length; idx++) {
+					var option = document.createElement("option");
+					option.value = tests[idx];
+					option.textContent = tests[idx];
+					this.testsSelect.appendChild(option);
+				}
+				
+				if (tests.length > 0) {
+					this.testsSelect.setAttribute("style", "");
+					this.debugTestButton.setAttribute("style", "");
+				}
+			}), function(error) {
+				// Not debugging a test binary
+			});
+			
+			this.debugTestButton.addEventListener("click", myCallback(this, function(e) {
+				var test = this.testsSelect.value;
+				
+				myXhr("POST", "/handle/exec/args", {
+					Args: ["-test.v", "-test.run=^" + test + "$"]
+				}).then(function(result) {
+					return myXhr("POST", "/handle/exec/run");
+				}).then(function(r) {}, handleXhrError);
+			}));
+		}
+	};
+	
+	testsWidget.init();
+	
+	// Attach to running Go processes and detach from them again
+	var processesWidget = {
+		processesSelect: document.getElementById("processes"),
+		attachButton: document.getElementById("attach"),
+		detachButton: document.getElementById("detach"),
+		
+		init: function() {
+			this.refresh();
+			
+			this.processesSelect.addEventListener("focus", myCallback(this, function(e) {
+				this.refresh();
+			}));
+			
+			this.attachButton.addEventListener("click", myCallback(this, function(e) {
+				var pid = parseInt(this.processesSelect.value, 10);
+				
+				if (!pid) {
+					return;
+				}
+				
+				myXhr("POST", "/handle/process/attach", {
+					Pid: pid
+				}).then(function(r) {}, handleXhrError);
+			}));
+			
+			clickCallback(this, this.detachButton, "POST", "/handle/process/detach");
+		},
+		
+		refresh: function() {
+			myXhr("POST", "/handle/process/list", {
+			}).then(myCallback(this, function(result) {
+				var processes = JSON.parse(result.response);
+				var selected = this.processesSelect.value;
+				
+				this.processesSelect.innerHTML = "";
+				
+				for (var idx = 0; idx < processes.length; idx++) {
+					var process = processes[idx];
+					
+					// Only Go programs are interesting here
+					if (!process.Go || process.Self) {
+						continue;
+					}
+					
+					var option = document.createElement("option");
+					option.value = process.Pid;
+					option.textContent = process.Pid + ": " + process.Path;
+					this.processesSelect.appendChild(option);
+				}
+				
+				this.processesSelect.value = selected;
+				
+				this.processesSelect.setAttribute("style", "");
+				this.attachButton.setAttribute("style", "");
+				this.detachButton.setAttribute("style", "");
+			}), function(error) {
+				// The debugger backend can't attach to processes
+			});
+		}
+	};
+	
+	processesWidget.init();
+	
 	var allBreakpointsWidget = {};
 	
 	var allVariablesWidget = {
 		variablesTable: document.getElementById("variablesTable"),
 		newExpressionInput: document.getElementById("addExpression"),
+		// Values shown for each variable object by name
+		valueSpans: {},
 		
 		init: function() {
 			this.newExpressionInput.addEventListener("keyup", myCallback(this, function(e) {
@@ -120,11 +357,39 @@ define(['orion/xhr'], function(xhr) {
 						var resultObj = JSON.parse(result.response);
 						
 						this.addVariable(resultObj, expression);
+						
+						// Remember the expression for the next stop and the next session
+						myXhr("POST", "/handle/expression/add", {
+							Expression: expression
+						}).then(function(result) {}, handleXhrError);
 					}), handleXhrError);
 				}
 			}));
 		},
 		
+		// Show the watch expressions that the user has added in the selected frame
+		addWatchExpressions: function() {
+			myXhr("POST", "/handle/expression/list", {
+			}).then(myCallback(this, function(result) {
+				var expressions = JSON.parse(result.response).Expressions;
+				
+				for (var idx = 0; idx < expressions.length; idx++) {
+					this.addWatchExpression(expressions[idx]);
+				}
+			}), handleXhrError);
+		},
+		
+		addWatchExpression: function(expression) {
+			myXhr("POST", "/handle/variable/create", {
+				Expression: expression
+			}).then(myCallback(this, function(result) {
+				this.addVariable(JSON.parse(result.response), expression);
+			}), myCallback(this, function(error) {
+				// The expression may not make sense in this frame
+				this.addVariable({value: error.responseText}, expression);
+			}));
+		},
+		
 		setVariables: function(variables) {
 			this.clearVariables();
 			
@@ -135,7 +400,8 @@ define(['orion/xhr'], function(xhr) {
 			}
 		},
 		
-		addVariable: function(variable, expression, parentExpression) {
+		// Children are indented by their level and put before a row, at the end if there is none
+		addVariable: function(variable, expression, parentExpression, beforeRow, level) {
 			var row = document.createElement("tr");
 			var nameColumn = document.createElement("td");
 			var typeColumn = document.createElement("td");
@@ -156,7 +422,10 @@ define(['orion/xhr'], function(xhr) {
 				}
 			}
 				
-			nameColumn.innerHTML = name;
+			nameColumn.textContent = name;
+			if (level) {
+				nameColumn.setAttribute("style", "padding-left: " + level + "em;");
+			}
 			
 			nameColumn.addEventListener("click", myCallback(this, function(e) {
 				var exprInput = this.newExpressionInput;
@@ -167,28 +436,180 @@ define(['orion/xhr'], function(xhr) {
 			}));
 			
 			if (variable.type) {
-				typeColumn.innerHTML = variable.type;
+				typeColumn.textContent = variable.type;
+			}
+			var valueSpan = document.createElement("span");
+			valueSpan.textContent = variable.value;
+			valueColumn.appendChild(valueSpan);
+			
+			// Values that changed since the last stop are shown in red
+			if (variable.changed) {
+				valueSpan.setAttribute("style", "color: red;");
+			}
+			if ((expression || parentExpression) && variable.name) {
+				this.valueSpans[variable.name] = valueSpan;
+				this.addFormatSelect(typeColumn, variable, valueSpan);
 			}
-			valueColumn.innerHTML = variable.value;
 			
-			this.variablesTable.appendChild(row);
+			// Double click a value to change it
+			valueSpan.addEventListener("dblclick", myCallback(this, function(e) {
+				var value = window.prompt("New value of " + name, variable.value);
+				
+				if (value === null) {
+					return;
+				}
+				
+				// Locals are listed by name, everything else has a variable object
+				var assignment = {Expression: name, Value: value};
+				if ((expression || parentExpression) && variable.name) {
+					assignment = {Name: variable.name, Value: value};
+				}
+				
+				myXhr("POST", "/handle/variable/assign", assignment).then(function(result) {
+					variable.value = JSON.parse(result.response).value;
+					valueSpan.textContent = variable.value;
+				}, handleXhrError);
+			}));
 			
-			// We only allow one level of traversal for now.
-			if (variable.numchild && variable.numchild !== "0" && !parentExpression) {				
-				myXhr("POST", "/handle/variable/listchildren", {
-					Name: variable.name, 
-					AllValues: true
-				}).then(myCallback(this, function(result){
-					var resultObj = JSON.parse(result.response);
+			if (expression && !parentExpression) {
+				var removeLink = document.createElement("a");
+				removeLink.innerHTML = " (remove)";
+				removeLink.setAttribute("href", "#");
+				valueColumn.appendChild(removeLink);
+				
+				removeLink.addEventListener("click", myCallback(this, function(e) {
+					e.preventDefault();
 					
-					for (var idx = 0; idx < resultObj.children.length; idx++) {
-						this.addVariable(resultObj.children[idx], resultObj.children[idx].expr, expression);
-					}
-				}), handleXhrError);
+					myXhr("POST", "/handle/expression/remove", {
+						Expression: expression
+					}).then(myCallback(this, function(result) {
+						this.variablesTable.removeChild(row);
+					}), handleXhrError);
+				}));
+			}
+			
+			this.variablesTable.insertBefore(row, beforeRow || null);
+			
+			var hasChildren = (variable.numchild && variable.numchild !== "0") || variable.dynamic === "1";
+			
+			if (hasChildren && !parentExpression) {
+				this.listChildren(variable, expression, row, 1, 0);
+			} else if (hasChildren && !variable.children) {
+				// Deeper children are listed when they are asked for
+				var expandLink = document.createElement("a");
+				expandLink.innerHTML = " (expand)";
+				expandLink.setAttribute("href", "#");
+				valueColumn.appendChild(expandLink);
+				
+				expandLink.addEventListener("click", myCallback(this, function(e) {
+					e.preventDefault();
+					
+					valueColumn.removeChild(expandLink);
+					this.listChildren(variable, name, row, (level || 0) + 1, 0);
+				}));
+			}
+			
+			return row;
+		},
+		
+		// List a page of the children of a variable, two levels deep, after its row
+		listChildren: function(variable, parentExpression, afterRow, level, from) {
+			return myXhr("POST", "/handle/variable/listchildren", {
+				Name: variable.name,
+				AllValues: true,
+				From: from,
+				Depth: 2
+			}).then(myCallback(this, function(result) {
+				this.addChildren(variable, JSON.parse(result.response), parentExpression, afterRow.nextSibling, level);
+			}), handleXhrError);
+		},
+		
+		addChildren: function(variable, children, parentExpression, beforeRow, level) {
+			for (var idx = 0; idx < children.children.length; idx++) {
+				var child = children.children[idx];
+				
+				this.addVariable(child, child.expr, parentExpression, beforeRow, level);
+				
+				if (child.children) {
+					this.addChildren(child, child.children, child.expr, beforeRow, level + 1);
+				}
+			}
+			
+			if (!children.has_more) {
+				return;
+			}
+			
+			// Big slices and maps are paged through
+			var shown = children.from + children.children.length;
+			var moreRow = document.createElement("tr");
+			var moreColumn = document.createElement("td");
+			moreColumn.setAttribute("colspan", "3");
+			moreColumn.setAttribute("style", "padding-left: " + level + "em;");
+			moreRow.appendChild(moreColumn);
+			
+			var moreLink = document.createElement("a");
+			// Pretty printers don't say how many children there are
+			if (children.total !== undefined) {
+				moreLink.textContent = "more... (" + shown + " of " + children.total + " shown)";
+			} else {
+				moreLink.textContent = "more... (" + shown + " shown)";
+			}
+			moreLink.setAttribute("href", "#");
+			moreColumn.appendChild(moreLink);
+			
+			moreLink.addEventListener("click", myCallback(this, function(e) {
+				e.preventDefault();
+				
+				this.listChildren(variable, parentExpression, moreRow, level, shown).then(myCallback(this, function() {
+					this.variablesTable.removeChild(moreRow);
+				}));
+			}));
+			
+			this.variablesTable.insertBefore(moreRow, beforeRow || null);
+		},
+		
+		// Let the user pick the format of a variable object's value
+		addFormatSelect: function(typeColumn, variable, valueSpan) {
+			var formatSelect = document.createElement("select");
+			var formats = ["natural", "hex", "binary", "octal", "decimal", "raw"];
+			
+			for (var idx = 0; idx < formats.length; idx++) {
+				var option = document.createElement("option");
+				option.setAttribute("value", formats[idx]);
+				option.innerHTML = formats[idx];
+				formatSelect.appendChild(option);
+			}
+			formatSelect.value = variable.format || "natural";
+			
+			formatSelect.addEventListener("change", function(e) {
+				myXhr("POST", "/handle/variable/format", {
+					Name: variable.name,
+					Format: formatSelect.value
+				}).then(function(result) {
+					variable.value = JSON.parse(result.response).value;
+					valueSpan.textContent = variable.value;
+				}, handleXhrError);
+			});
+			
+			typeColumn.appendChild(document.createTextNode(" "));
+			typeColumn.appendChild(formatSelect);
+		},
+		
+		// Show the values of variable objects that changed as the program stopped
+		updateVariables: function(changes) {
+			for (var idx = 0; idx < changes.length; idx++) {
+				var valueSpan = this.valueSpans[changes[idx].Name];
+				
+				if (valueSpan && changes[idx].InScope) {
+					valueSpan.textContent = changes[idx].Value;
+					valueSpan.setAttribute("style", "color: red;");
+				}
 			}
 		},
 		
 		clearVariables: function() {
+			this.valueSpans = {};
+			
 			var childrenToRemove = [];
 			
 			for (var idx = 0; idx < this.variablesTable.childNodes.length; idx++) {
@@ -209,6 +630,8 @@ define(['orion/xhr'], function(xhr) {
 			
 			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("z-index: 50;", "z-index: 100;"));
 			this.breakpointsWidget.hide();
+			registersWidget.hide();
+			memoryWidget.hide();
 		},
 		
 		hide: function() {
@@ -226,6 +649,213 @@ define(['orion/xhr'], function(xhr) {
 	
 	allVariablesWidget.init();
 	
+	// Registers of the stopped program, the ones that changed since the
+	//  last stop are shown in red
+	var registersWidget = {
+		registersTable: document.getElementById("registersTable"),
+		showing: false,
+		
+		refresh: function() {
+			if (!this.showing) {
+				return;
+			}
+			
+			myXhr("POST", "/handle/registers").then(myCallback(this, function(result) {
+				this.setRegisters(JSON.parse(result.response));
+			}), myCallback(this, function(error) {
+				this.setRegisters({Registers: [], Summary: null});
+			}));
+		},
+		
+		setRegisters: function(result) {
+			while (this.registersTable.lastElementChild !== this.registersTable.firstElementChild) {
+				this.registersTable.removeChild(this.registersTable.lastElementChild);
+			}
+			
+			var summary = result.Summary;
+			if (summary) {
+				var parts = [];
+				if (summary.Goroutine) {
+					parts.push("g (" + summary.Goroutine.Name + ") = " + summary.Goroutine.Value);
+				}
+				parts.push("sp (" + summary.StackPointer.Name + ") = " + summary.StackPointer.Value);
+				parts.push("pc (" + summary.ProgramCounter.Name + ") = " + summary.ProgramCounter.Value);
+				
+				var summaryRow = document.createElement("tr");
+				summaryRow.innerHTML = '<td style="font-weight: bold;">' + escapeHtml(summary.Arch) + '</td><td style="font-weight: bold;">' + escapeHtml(parts.join(", ")) + "</td>";
+				this.registersTable.appendChild(summaryRow);
+			}
+			
+			for (var idx = 0; idx < result.Registers.length; idx++) {
+				this.addRegister(result.Registers[idx]);
+			}
+		},
+		
+		addRegister: function(register) {
+			var row = document.createElement("tr");
+			var nameElement = document.createElement("td");
+			var valueElement = document.createElement("td");
+			
+			nameElement.textContent = register.Name;
+			valueElement.textContent = register.Value;
+			if (register.Changed) {
+				valueElement.setAttribute("style", "color: red;");
+			}
+			
+			// Double click a value to change it
+			valueElement.addEventListener("dblclick", myCallback(this, function(e) {
+				var value = window.prompt("New value of " + register.Name, register.Value);
+				
+				if (value) {
+					myXhr("POST", "/handle/registers/set", {
+						Name: register.Name,
+						Value: value
+					}).then(myCallback(this, function(result) {
+						this.setRegisters(JSON.parse(result.response));
+					}), handleXhrError);
+				}
+			}));
+			
+			row.appendChild(nameElement);
+			row.appendChild(valueElement);
+			this.registersTable.appendChild(row);
+		},
+		
+		show: function() {
+			var parentPanel = this.registersTable.parentNode;
+			
+			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("z-index: 50;", "z-index: 100;"));
+			allVariablesWidget.hide();
+			allBreakpointsWidget.hide();
+			memoryWidget.hide();
+			
+			this.showing = true;
+			this.refresh();
+		},
+		
+		hide: function() {
+			var parentPanel = this.registersTable.parentNode;
+			
+			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("z-index: 100;", "z-index: 50;"));
+			this.showing = false;
+		}
+	};
+	
+	// Hex dump of the memory at an address, a page at a time
+	var memoryWidget = {
+		memoryTable: document.getElementById("memoryTable"),
+		addressInput: document.getElementById("memoryAddress"),
+		typeSelect: document.getElementById("memoryType"),
+		pageSize: 256,
+		offset: 0,
+		
+		init: function() {
+			this.addressInput.addEventListener("keyup", myCallback(this, function(e) {
+				if (e.keyCode === 13) {
+					this.offset = 0;
+					this.refresh();
+				}
+			}));
+			this.typeSelect.addEventListener("change", myCallback(this, function(e) {
+				this.refresh();
+			}));
+			document.getElementById("memoryPrevious").addEventListener("click", myCallback(this, function(e) {
+				this.offset -= this.pageSize;
+				this.refresh();
+			}));
+			document.getElementById("memoryNext").addEventListener("click", myCallback(this, function(e) {
+				this.offset += this.pageSize;
+				this.refresh();
+			}));
+		},
+		
+		refresh: function() {
+			if (this.addressInput.value === "") {
+				return;
+			}
+			
+			myXhr("POST", "/handle/memory/read", {
+				Address: this.addressInput.value,
+				Offset: this.offset,
+				Count: this.pageSize,
+				Type: this.typeSelect.value
+			}).then(myCallback(this, function(result) {
+				this.setPage(JSON.parse(result.response));
+			}), myCallback(this, function(error) {
+				this.setPage({Lines: []});
+				
+				var row = document.createElement("tr");
+				row.innerHTML = '<td colspan="3">' + escapeHtml(error.responseText) + "</td>";
+				this.memoryTable.appendChild(row);
+			}));
+		},
+		
+		setPage: function(page) {
+			while (this.memoryTable.lastElementChild !== this.memoryTable.firstElementChild) {
+				this.memoryTable.removeChild(this.memoryTable.lastElementChild);
+			}
+			
+			for (var idx = 0; idx < page.Lines.length; idx++) {
+				this.addLine(page.Lines[idx]);
+			}
+			
+			if (page.Values) {
+				var row = document.createElement("tr");
+				row.innerHTML = '<td colspan="3">' + escapeHtml(this.typeSelect.value + ": " + page.Values.join(" ")) + "</td>";
+				this.memoryTable.appendChild(row);
+			}
+		},
+		
+		addLine: function(line) {
+			var row = document.createElement("tr");
+			var addressElement = document.createElement("td");
+			var hexElement = document.createElement("td");
+			var asciiElement = document.createElement("td");
+			
+			addressElement.textContent = line.Address;
+			hexElement.textContent = line.Hex;
+			asciiElement.textContent = line.ASCII;
+			
+			// Double click the bytes of a line to patch them
+			hexElement.addEventListener("dblclick", myCallback(this, function(e) {
+				var contents = window.prompt("New bytes at " + line.Address, line.Hex);
+				
+				if (contents) {
+					myXhr("POST", "/handle/memory/write", {
+						Address: line.Address,
+						Contents: contents
+					}).then(myCallback(this, function(result) {
+						this.refresh();
+					}), handleXhrError);
+				}
+			}));
+			
+			row.appendChild(addressElement);
+			row.appendChild(hexElement);
+			row.appendChild(asciiElement);
+			this.memoryTable.appendChild(row);
+		},
+		
+		show: function() {
+			var parentPanel = this.memoryTable.parentNode;
+			
+			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("z-index: 50;", "z-index: 100;"));
+			allVariablesWidget.hide();
+			allBreakpointsWidget.hide();
+			registersWidget.hide();
+			
+			this.addressInput.focus();
+		},
+		
+		hide: function() {
+			var parentPanel = this.memoryTable.parentNode;
+			
+			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("z-index: 100;", "z-index: 50;"));
+		}
+	};
+	
+	memoryWidget.init();
+	
 	var allThreadsWidget = {
 		selectedThread: "",
 		threadWidgets: {},
@@ -294,7 +924,7 @@ define(['orion/xhr'], function(xhr) {
 								this.name = thread['target-id'];
 								this.state = thread.state;
 								
-								this.nameElement.innerHTML = this.name;
+								this.nameElement.textContent = this.name;
 								
 								// Fill in the top-level of the stack
 								this.setStack([thread.frame], false);
@@ -366,11 +996,11 @@ define(['orion/xhr'], function(xhr) {
 								var fileColumn = document.createElement("td");
 								this.row.appendChild(funcColumn);
 								this.row.appendChild(fileColumn);
-								funcColumn.innerHTML = frame.func;
+								funcColumn.textContent = frame.func;
 								funcColumn.setAttribute("style", "width: 50%; padding: 0px 10px 0px 0px;");
 								if (frame.file !== "") {				
 									var compact = this.trimFile(this.frame.file) + ":" + this.frame.line;
-									fileColumn.innerHTML = compact;
+									fileColumn.textContent = compact;
 								}
 								fileColumn.setAttribute("style", "width: 50%; max-width: 300px; overflow: hidden; text-overflow: clip; white-space: nowrap;");
 								this.frameTable.appendChild(this.row);
@@ -411,11 +1041,21 @@ define(['orion/xhr'], function(xhr) {
 								}).then(myCallback(this, function(result){
 									var variables = JSON.parse(result.response).variables;
 									allVariablesWidget.setVariables(variables);
+									allVariablesWidget.addWatchExpressions();
 								}), function(error) {
 									// Ignore errors on the variables list.
 									// TODO Should we invalidate the parent thread or frame somehow?
 								});
 
+								registersWidget.refresh();
+								memoryWidget.refresh();
+
+								disassemblyWidget.frame = this;
+								if (disassemblyWidget.showing) {
+									disassemblyWidget.show(this);
+									return;
+								}
+
 								myXhr("POST", "/handle/file/get", {
 									File: this.frame.file
 								}).then(myCallback(this, function(result){
@@ -439,12 +1079,13 @@ define(['orion/xhr'], function(xhr) {
 											html = html + ' id="scrolltoLine"';
 										}
 
-										html = html + ">" + idx + ": "+ lines[idx-1] + "</pre>";
+										html = html + ' data-line="' + idx + '">' + idx + ": "+ escapeHtml(lines[idx-1]) + "</pre>";
 									}
 
 									document.getElementById("fileArea").innerHTML = html;
+									document.getElementById("fileArea").setAttribute("data-file", this.frame.fullname || this.frame.file);
 									document.getElementById("scrolltoLine").scrollIntoView(true);
-									document.getElementById("filePath").innerHTML = this.frame.file;
+									document.getElementById("filePath").textContent = this.frame.file;
 								}), function(error) {
 									document.getElementById("fileArea").innerHTML = "";
 									document.getElementById("filePath").innerHTML = "";
@@ -546,7 +1187,8 @@ define(['orion/xhr'], function(xhr) {
 			}
 		},
 		
-		handleAllThreadsStopped: function(currentThread) {
+		// The current thread shows a frame level if one is given
+		handleAllThreadsStopped: function(currentThread, frameLevel) {
 			if (currentThread !== "all") {
 				this.addThread(currentThread);
 				this.selectThread(currentThread);
@@ -566,6 +1208,9 @@ define(['orion/xhr'], function(xhr) {
 				}
 				
 				if (currentThreadId !== "") {
+					if (frameLevel && this.threadWidgets[currentThreadId]) {
+						this.threadWidgets[currentThreadId].selectedFrame = frameLevel;
+					}
 					this.selectThread(currentThreadId);
 				}
 			}), handleXhrError);
@@ -592,6 +1237,12 @@ define(['orion/xhr'], function(xhr) {
 	allBreakpointsWidget = {
 		breakpointsTable: document.getElementById("breakpointTable"),
 		addBreakpointInput: document.getElementById("addBreakpoint"),
+		addWatchpointInput: document.getElementById("addWatchpoint"),
+		watchpointTypeSelect: document.getElementById("watchpointType"),
+		addLogpointLocationInput: document.getElementById("addLogpointLocation"),
+		addLogpointFormatInput: document.getElementById("addLogpointFormat"),
+		catchTypeSelect: document.getElementById("catchType"),
+		addCatchpointInput: document.getElementById("addCatchpoint"),
 		
 		breakpointWidgets: {},
 		variablesWidget: allVariablesWidget,
@@ -608,6 +1259,49 @@ define(['orion/xhr'], function(xhr) {
 					}), handleXhrError);
 				}
 			}));
+			
+			this.addWatchpointInput.addEventListener("keyup", myCallback(this, function(e) {
+				if (e.keyCode === 13) {
+					myXhr("POST", "/handle/watchpoint/insert", {
+						Expression: this.addWatchpointInput.value,
+						Type: this.watchpointTypeSelect.value
+					}).then(myCallback(this, function(result){
+						var resultObj = JSON.parse(result.response);
+						this.addBreakpoint(resultObj.bkpt);
+						this.addWatchpointInput.value = "";
+					}), handleXhrError);
+				}
+			}));
+			
+			this.addLogpointFormatInput.addEventListener("keyup", myCallback(this, function(e) {
+				if (e.keyCode === 13) {
+					myXhr("POST", "/handle/logpoint/insert", {
+						Location: this.addLogpointLocationInput.value,
+						Format: this.addLogpointFormatInput.value
+					}).then(myCallback(this, function(result){
+						var resultObj = JSON.parse(result.response);
+						this.addBreakpoint(resultObj.bkpt);
+						this.addLogpointLocationInput.value = "";
+						this.addLogpointFormatInput.value = "";
+					}), handleXhrError);
+				}
+			}));
+			
+			this.addCatchpointInput.addEventListener("keyup", myCallback(this, function(e) {
+				if (e.keyCode === 13) {
+					var names = this.addCatchpointInput.value.split(/[\s,]+/).filter(function(name) {
+						return name !== "";
+					});
+					
+					myXhr("POST", "/handle/catch/" + this.catchTypeSelect.value, {
+						Names: names
+					}).then(myCallback(this, function(result){
+						var resultObj = JSON.parse(result.response);
+						this.addBreakpoint(resultObj.bkpt);
+						this.addCatchpointInput.value = "";
+					}), handleXhrError);
+				}
+			}));
 		},
 		
 		addBreakpoint: function(breakpoint) {
@@ -628,14 +1322,36 @@ define(['orion/xhr'], function(xhr) {
 					this.funcElement = document.createElement("td");
 					this.fileElement = document.createElement("td");
 					this.lineElement = document.createElement("td");
+					this.condElement = document.createElement("td");
+					this.deleteElement = document.createElement("td");
 					this.row.appendChild(this.idElement);
 					this.row.appendChild(this.funcElement);
 					this.row.appendChild(this.fileElement);
 					this.row.appendChild(this.lineElement);
+					this.row.appendChild(this.condElement);
+					this.row.appendChild(this.deleteElement);
 					this.idElement.innerHTML = breakpoint.number;
-					this.funcElement.innerHTML = breakpoint.func;
-					this.fileElement.innerHTML = breakpoint.file;
+					this.funcElement.textContent = breakpoint.func || "";
+					this.fileElement.textContent = breakpoint.file || "";
 					this.lineElement.innerHTML = breakpoint.line;
+					this.deleteElement.innerHTML = "x";
+					this.update(breakpoint);
+					
+					if (breakpoint.disp === "del") {
+						this.idElement.innerHTML = breakpoint.number + " (temporary)";
+					}
+					if (breakpoint.type === "logpoint") {
+						this.funcElement.textContent = "log \"" + breakpoint.what + "\"";
+						this.setHits(breakpoint.times);
+					} else if (breakpoint.what) {
+						// Watchpoints have an expression rather than a location
+						this.funcElement.textContent = breakpoint.type;
+						this.fileElement.textContent = breakpoint.what;
+					}
+					if (breakpoint.pending) {
+						this.funcElement.textContent = "<pending>";
+						this.fileElement.textContent = breakpoint.pending;
+					}
 					
 					this.breakpointsTable.appendChild(this.row);
 					
@@ -650,6 +1366,54 @@ define(['orion/xhr'], function(xhr) {
 							this.enable();
 						}
 					}));
+					
+					this.condElement.addEventListener("click", myCallback(this, function(e) {
+						// Editing the condition shouldn't toggle the breakpoint
+						e.stopPropagation();
+						
+						var condition = window.prompt("Stop only when this expression is true (leave empty to always stop)", this.condition);
+						if (condition === null) {
+							return;
+						}
+						
+						myXhr("POST", "/handle/breakpoint/condition", {
+							Number: this.id,
+							Condition: condition
+						}).then(myCallback(this, function(result){
+							this.update(JSON.parse(result.response).bkpt);
+						}), handleXhrError);
+					}));
+					
+					this.deleteElement.addEventListener("click", myCallback(this, function(e) {
+						e.stopPropagation();
+						
+						myXhr("POST", "/handle/breakpoint/delete", {
+							Breakpoints: [this.id]
+						}).then(myCallback(this, function(result){
+							allBreakpointsWidget.removeBreakpoint(this.id);
+						}), handleXhrError);
+					}));
+				},
+				
+				update: function(breakpoint) {
+					this.condition = breakpoint.cond || "";
+					
+					var summary = this.condition;
+					if (breakpoint.ignore) {
+						summary = summary + " (ignore next " + breakpoint.ignore + ")";
+					}
+					if (summary === "") {
+						summary = "<always>";
+					}
+					this.condElement.textContent = summary;
+				},
+				
+				setHits: function(hits) {
+					this.idElement.innerHTML = this.id + " (" + hits + " hits)";
+				},
+				
+				remove: function() {
+					this.breakpointsTable.removeChild(this.row);
 				},
 				
 				disable: function() {
@@ -679,11 +1443,33 @@ define(['orion/xhr'], function(xhr) {
 			breakpointWidget.init();
 		},
 		
+		removeBreakpoint: function(number) {
+			var breakpointWidget = this.breakpointWidgets[number];
+			
+			if (breakpointWidget) {
+				breakpointWidget.remove();
+				delete this.breakpointWidgets[number];
+			}
+		},
+		
+		// Show exactly the breakpoints in a breakpoint table
+		setBreakpoints: function(bps) {
+			for (var number in this.breakpointWidgets) {
+				this.removeBreakpoint(number);
+			}
+			
+			for (var idx = 0 ; idx < bps.length; idx++) {
+				this.addBreakpoint(bps[idx]);
+			}
+		},
+		
 		show: function() {
 			var parentPanel = this.breakpointsTable.parentNode;
 			
 			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("z-index: 50;", "z-index: 100;"));
 			this.variablesWidget.hide();
+			registersWidget.hide();
+			memoryWidget.hide();
 			
 			// Breakpoints widget is now shown. User may want to begin typing a
 			//  new breakpoint.
@@ -702,6 +1488,10 @@ define(['orion/xhr'], function(xhr) {
 			parentPanel.setAttribute("style", parentPanel.getAttribute("style").replace("background: white;", "background: grey"));
 			
 			this.addBreakpointInput.disabled = true;
+			this.addWatchpointInput.disabled = true;
+			this.addLogpointLocationInput.disabled = true;
+			this.addLogpointFormatInput.disabled = true;
+			this.addCatchpointInput.disabled = true;
 		}
 	};
 	
@@ -714,51 +1504,207 @@ define(['orion/xhr'], function(xhr) {
 	document.getElementById("showBreakpoints").addEventListener("click", function(e) {
 		allBreakpointsWidget.show();
 	});
+	document.getElementById("showRegisters").addEventListener("click", function(e) {
+		registersWidget.show();
+	});
+	document.getElementById("showMemory").addEventListener("click", function(e) {
+		memoryWidget.show();
+	});
 	
-	// Initial list of breakpoints
-	myXhr("POST", "/handle/breakpoint/list", {
-	}).then(function(result){
-		var resultObj = JSON.parse(result.response);
-		
-		var bps = resultObj.BreakPointTable.body;
-		
-		for (var idx = 0 ; idx < bps.length; idx++) {
-			allBreakpointsWidget.addBreakpoint(bps[idx]);
+	document.getElementById("exportSession").addEventListener("click", function(e) {
+		window.location.href = "/handle/session/export";
+	});
+	
+	var importFile = document.getElementById("importFile");
+	document.getElementById("importSession").addEventListener("click", function(e) {
+		importFile.click();
+	});
+	importFile.addEventListener("change", function(e) {
+		if (importFile.files.length === 0) {
+			return;
 		}
-	}, handleXhrError);
+		
+		var reader = new FileReader();
+		reader.onload = function() {
+			importFile.value = "";
+			
+			var state;
+			try {
+				state = JSON.parse(reader.result);
+			} catch (err) {
+				window.alert("Not a saved session: " + err);
+				return;
+			}
+			
+			myXhr("POST", "/handle/session/import", state).then(function(result) {
+				var problems = JSON.parse(result.response).Problems;
+				
+				if (problems.length > 0) {
+					window.alert("Some breakpoints could not be imported:\n" + problems.join("\n"));
+				}
+				loadBreakpoints();
+			}, handleXhrError);
+		};
+		reader.readAsText(importFile.files[0]);
+	});
+	
+	// Load the list of breakpoints known to the debugger
+	var loadBreakpoints = function() {
+		myXhr("POST", "/handle/breakpoint/list", {
+		}).then(function(result){
+			var resultObj = JSON.parse(result.response);
+			
+			allBreakpointsWidget.setBreakpoints(resultObj.BreakPointTable.body);
+		}, handleXhrError);
+	};
 	
 	var outputArea = document.getElementById("outputArea");
 	
+	// Output is added as text so that the program can't inject markup
+	var appendOutput = function(text) {
+		outputArea.appendChild(document.createTextNode(text));
+		outputArea.scrollIntoView(false);
+	};
+	
 	var wsUrl = document.URL.replace("http://", "ws://") + "output";
 	wsUrl = wsUrl.replace("https://", "wss://");
-	var websocket = new WebSocket(wsUrl);
-	//websocket.onopen = function(evt) {  };
-	websocket.onclose = function(evt) {
-		window.alert("Connection to debugger has been closed");
-		
-		document.body.setAttribute("style", "overflow: hidden; background: grey;");
-		
-		allVariablesWidget.disable();
-		allBreakpointsWidget.disable();
-		allThreadsWidget.disable();
-		executionWidget.disable();
-		interruptButton.disabled = true;
-		exitButton.disabled = true;
+	
+	// The debug session outlives the connection so we keep trying to
+	//  reconnect for a while before giving up.
+	var maxReconnectAttempts = 30;
+	var reconnectAttempts = 0;
+	var exiting = false;
+	
+	// Sequence number of the last event seen so that a reconnect only
+	//  needs to replay what we missed.
+	var lastSeq = 0;
+	
+	exitButton.addEventListener("click", function(e) {
+		exiting = true;
+	});
+	
+	var connect = function() {
+		var websocket = new WebSocket(wsUrl + "?since=" + lastSeq);
+		
+		websocket.onopen = function(evt) {
+			reconnectAttempts = 0;
+		};
+		websocket.onclose = function(evt) {
+			if (!exiting && reconnectAttempts < maxReconnectAttempts) {
+				reconnectAttempts++;
+				window.setTimeout(connect, 2000);
+				return;
+			}
+			
+			window.alert("Connection to debugger has been closed");
+			
+			document.body.setAttribute("style", "overflow: hidden; background: grey;");
+			
+			allVariablesWidget.disable();
+			allBreakpointsWidget.disable();
+			allThreadsWidget.disable();
+			executionWidget.disable();
+			interruptButton.disabled = true;
+			exitButton.disabled = true;
+		};
+		websocket.onmessage = handleEvent;
 	};
-	websocket.onmessage = function(evt) {
+	
+	var handleEvent = function(evt) {
 		var event = JSON.parse(evt.data);
 		var type = event.Type;
 		
+		if (event.Seq) {
+			lastSeq = event.Seq;
+		}
+		
 		// TODO decouple the console, target and gdb logs
 		if (type === "console" || type === "target" || type === "gdb") {
 			var message = event.Data;
 			
-			message = message.replace("<", "&lt;");
-			message = message.replace(">", "&gt;");
+			appendOutput("[" + type + "] " + message);
+		} else if (type === "logpoint") {
+			var logpoint = event.Data;
+			var message = logpoint.Message;
+			
+			appendOutput("[log " + logpoint.Number + "] " + message + "\n");
+			
+			var logpointWidget = allBreakpointsWidget.breakpointWidgets[logpoint.Number];
+			if (logpointWidget) {
+				logpointWidget.setHits(logpoint.Hits);
+			}
+		} else if (type === "catch") {
+			var caught = event.Data;
+			var message = "Catchpoint " + caught.Number + " (" + caught.Kind + ")";
+			
+			if (caught.SyscallName || caught.SyscallNumber) {
+				message = message + " " + (caught.SyscallName || "") + " [" + caught.SyscallNumber + "]";
+			} else if (caught.Signal) {
+				message = message + " " + caught.Signal;
+			} else if (caught.NewPid) {
+				message = message + " new process " + caught.NewPid;
+			} else if (caught.NewExec) {
+				message = message + " " + caught.NewExec;
+			}
+			
+			appendOutput("[catch] " + message + "\n");
+		} else if (type === "panic") {
+			var panicked = event.Data;
+			var message = "Stopped in " + panicked.Function + ": " + panicked.Value;
+			
+			if (panicked.Frame.file) {
+				message = message + " at " + panicked.Frame.file + ":" + panicked.Frame.line;
+			}
+			
+			appendOutput("[panic] " + message + "\n");
 			
-			outputArea.innerHTML = outputArea.innerHTML + "[" + type + "] " + message;
+			// Show the frame that panicked rather than the runtime's
+			var panickedThread = allThreadsWidget.threadWidgets[panicked.ThreadId];
+			if (panickedThread && panicked.Frame.level) {
+				panickedThread.selectedFrame = panicked.Frame.level;
+				allThreadsWidget.selectThread(panicked.ThreadId);
+			}
+		} else if (type === "varobj-update") {
+			allVariablesWidget.updateVariables(event.Data);
+		} else if (type === "watchpoint-trigger") {
+			var trigger = event.Data;
+			var message = "Watchpoint " + trigger.Number + " (" + trigger.Kind + ") " + trigger.Expression;
 			
-			outputArea.scrollIntoView(false);
+			if (trigger.Old || trigger.New) {
+				message = message + ": " + trigger.Old + " -> " + trigger.New;
+			} else if (trigger.Value) {
+				message = message + ": " + trigger.Value;
+			}
+			if (trigger.Frame.file) {
+				message = message + " at " + trigger.Frame.file + ":" + trigger.Frame.line;
+			}
+			
+			appendOutput("[watch] " + message + "\n");
+		} else if (type === "resync") {
+			// We may have missed any number of events so rebuild the view
+			//  from the current state of the session.
+			lastSeq = event.Data.Seq;
+			
+			myXhr("POST", "/handle/session/state", {
+			}).then(function(result) {
+				var state = JSON.parse(result.response);
+				
+				// Breakpoints deleted while we were away go away here too
+				allBreakpointsWidget.setBreakpoints(state.Breakpoints.BreakPointTable.body || []);
+				
+				if (state.ReadOnly) {
+					executionWidget.readOnly = true;
+					executionWidget.disable();
+					interruptButton.disabled = true;
+				}
+				
+				// Threads, frames and variables are all redrawn
+				allThreadsWidget.handleAllThreadsRunning("all");
+				
+				if (state.State === "stopped") {
+					allThreadsWidget.handleAllThreadsStopped("all", state.Frame ? state.Frame.frame.level : "0");
+				}
+			}, handleXhrError);
 		} else if (type === "async") {
 			// Asynchronous result record
 			
@@ -771,10 +1717,23 @@ define(['orion/xhr'], function(xhr) {
 			} else if (record.Indication === "stopped") {
 				var threadId = record.Result['thread-id'];
 				
+				if (record.Result.reason === "function-finished" && record.Result["return-value"] !== undefined) {
+					var returned = "Returned " + record.Result["return-value"];
+					
+					appendOutput("[finish] " + returned + "\n");
+				}
+				
+				// Temporary breakpoints are deleted once they are hit
+				if (record.Result.disp === "del" && record.Result.bkptno) {
+					allBreakpointsWidget.removeBreakpoint(record.Result.bkptno);
+				}
+				
 				if (record.Result.reason && record.Result.reason.substring(0,6) !== "exited") {
 					// All threads are stopped in all-stop mode
 					allThreadsWidget.handleAllThreadsStopped(threadId);
 				}
+			} else if (record.Indication === "breakpoint-deleted") {
+				allBreakpointsWidget.removeBreakpoint(record.Result.id);
 			} else if (record.Indication === "running") {
 				var threadId = record.Result['thread-id'];
 				
@@ -783,4 +1742,6 @@ define(['orion/xhr'], function(xhr) {
 			}
 		}
 	};
+	
+	connect();
 });
\ No newline at end of file
@@ -0,0 +1,237 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// catcher is implemented by the backends that can stop the program on
+// events other than reaching a location. Each method returns the number
+// of the new catchpoint.
+type catcher interface {
+	CatchSyscall(syscalls []string) (string, error)
+	CatchSignal(signals []string) (string, error)
+	CatchFork(vfork bool) (string, error)
+	CatchExec() (string, error)
+}
+
+// Syscalls and signals are given to gdb on its command line so anything
+// other than a plain name or number is refused.
+var catchNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// gdb has no MI fields for signal catchpoints, the stop record has no
+// reason and the catchpoint is only told of on the console.
+var signalCatchPattern = regexp.MustCompile(`Catchpoint (\d+) \(signal (\w+)\)`)
+
+// catch sets a catchpoint with a gdb command since there are no MI
+// commands for them. The command doesn't give the number of the new
+// catchpoint so it is the one of the kind that wasn't there before.
+func (d gdbDebugger) catch(kind string, names []string) (string, error) {
+	for _, name := range names {
+		if !catchNamePattern.MatchString(name) {
+			return "", errors.New("Invalid name to catch: " + name)
+		}
+	}
+
+	before, err := d.catchpoints(kind)
+	if err != nil {
+		return "", err
+	}
+
+	err = d.console(strings.TrimSpace("catch " + kind + " " + strings.Join(names, " ")))
+	if err != nil {
+		return "", err
+	}
+
+	after, err := d.catchpoints(kind)
+	if err != nil {
+		return "", err
+	}
+
+	number := newCatchpoint(before, after)
+	if number == "" {
+		return "", errors.New("Could not catch " + kind)
+	}
+	return number, nil
+}
+
+// catchpoints gives the numbers of the catchpoints of a kind.
+func (d gdbDebugger) catchpoints(kind string) ([]string, error) {
+	result, err := d.BreakList()
+	if err != nil {
+		return nil, err
+	}
+
+	breakpoints := miBreakList{}
+	err = remarshal(result, &breakpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	numbers := []string{}
+	for _, bp := range breakpoints.BreakPointTable.Body {
+		if bp.Type == "catchpoint" && bp.CatchType == kind {
+			numbers = append(numbers, bp.Number)
+		}
+	}
+	return numbers, nil
+}
+
+// newCatchpoint picks the catchpoint that is in after but not before.
+// Should another client have set one of the same kind in the meantime the
+// lowest numbered one is taken.
+func newCatchpoint(before []string, after []string) string {
+	existing := make(map[string]bool)
+	for _, number := range before {
+		existing[number] = true
+	}
+
+	number := ""
+	lowest := 0
+	for _, candidate := range after {
+		n, err := strconv.Atoi(candidate)
+		if err != nil || existing[candidate] {
+			continue
+		}
+		if number == "" || n < lowest {
+			number = candidate
+			lowest = n
+		}
+	}
+	return number
+}
+
+func (d gdbDebugger) CatchSyscall(syscalls []string) (string, error) {
+	return d.catch("syscall", syscalls)
+}
+
+func (d gdbDebugger) CatchSignal(signals []string) (string, error) {
+	return d.catch("signal", signals)
+}
+
+func (d gdbDebugger) CatchFork(vfork bool) (string, error) {
+	if vfork {
+		return d.catch("vfork", nil)
+	}
+	return d.catch("fork", nil)
+}
+
+func (d gdbDebugger) CatchExec() (string, error) {
+	return d.catch("exec", nil)
+}
+
+// catchEvent is sent to the web clients when the program stops at a
+// catchpoint. Only the fields for the kind of catchpoint are set.
+type catchEvent struct {
+	Number string
+	// One of syscall-entry, syscall-return, signal, fork, vfork or exec
+	Kind          string
+	SyscallNumber string `json:",omitempty"`
+	SyscallName   string `json:",omitempty"`
+	Signal        string `json:",omitempty"`
+	NewPid        string `json:",omitempty"`
+	NewExec       string `json:",omitempty"`
+	ThreadId      string
+	Frame         miFrame
+}
+
+type miCatchStop struct {
+	miStop
+	Number        string `json:"bkptno"`
+	SyscallNumber string `json:"syscall-number"`
+	SyscallName   string `json:"syscall-name"`
+	NewPid        string `json:"newpid"`
+	NewExec       string `json:"new-exec"`
+}
+
+// catchStop picks apart the stop record of a catchpoint. The console line
+// given before the stop, if any, tells of signal catchpoints.
+func catchStop(record gdblib.AsyncResultRecord, consoleLine string) (*catchEvent, bool) {
+	if record.Indication != "stopped" {
+		return nil, false
+	}
+
+	stop := miCatchStop{}
+	err := remarshal(record.Result, &stop)
+	if err != nil {
+		return nil, false
+	}
+
+	event := &catchEvent{Number: stop.Number, Kind: stop.Reason, ThreadId: stop.ThreadId, Frame: stop.Frame}
+
+	switch stop.Reason {
+	case "syscall-entry", "syscall-return":
+		event.SyscallNumber = stop.SyscallNumber
+		event.SyscallName = stop.SyscallName
+	case "fork", "vfork":
+		event.NewPid = stop.NewPid
+	case "exec":
+		event.NewExec = stop.NewExec
+	case "":
+		match := signalCatchPattern.FindStringSubmatch(consoleLine)
+		if match == nil {
+			return nil, false
+		}
+		event.Number = match[1]
+		event.Kind = "signal"
+		event.Signal = match[2]
+	default:
+		return nil, false
+	}
+
+	return event, true
+}
+
+func addCatchHandlers(mycatcher catcher, mysession *session) {
+	// Each catch handler responds with the new catchpoint
+	catchHandler := func(catch func(names []string) (string, error)) handlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			parms := struct {
+				// Syscalls or signals to catch, all of them if empty
+				Names []string
+			}{}
+
+			decoder := json.NewDecoder(r.Body)
+			err := decoder.Decode(&parms)
+
+			// There is nothing to give when catching fork or exec
+			if err != nil && err != io.EOF {
+				w.WriteHeader(400)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			number, err := catch(parms.Names)
+
+			if err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte(err.Error()))
+				return
+			}
+
+			writeBreakpoint(w, mysession.mygdb, mysession.logpoints, number)
+		}
+	}
+
+	http.HandleFunc("/handle/catch/syscall", wrapHandlerFunc(catchHandler(mycatcher.CatchSyscall)))
+	http.HandleFunc("/handle/catch/signal", wrapHandlerFunc(catchHandler(mycatcher.CatchSignal)))
+	http.HandleFunc("/handle/catch/fork", wrapHandlerFunc(catchHandler(func(names []string) (string, error) {
+		return mycatcher.CatchFork(false)
+	})))
+	http.HandleFunc("/handle/catch/vfork", wrapHandlerFunc(catchHandler(func(names []string) (string, error) {
+		return mycatcher.CatchFork(true)
+	})))
+	http.HandleFunc("/handle/catch/exec", wrapHandlerFunc(catchHandler(func(names []string) (string, error) {
+		return mycatcher.CatchExec()
+	})))
+}
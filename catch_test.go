@@ -0,0 +1,88 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/sirnewton01/godbg/gdblib"
+	"reflect"
+	"testing"
+)
+
+func stopRecord(result map[string]interface{}) gdblib.AsyncResultRecord {
+	frame := map[string]interface{}{"addr": "0x0000000000465e83", "func": "main.main",
+		"file": "main.go", "fullname": "/src/main.go", "line": "12"}
+
+	record := gdblib.AsyncResultRecord{Indication: "stopped", Result: map[string]interface{}{
+		"frame": frame, "thread-id": "1", "stopped-threads": "all", "core": "3"}}
+	for key, value := range result {
+		record.Result[key] = value
+	}
+	return record
+}
+
+var catchFrame = miFrame{Addr: "0x0000000000465e83", Func: "main.main", File: "main.go", Fullname: "/src/main.go", Line: "12"}
+
+var catchStopTests = []struct {
+	record      gdblib.AsyncResultRecord
+	consoleLine string
+	event       *catchEvent
+}{
+	// *stopped,reason="syscall-entry",disp="keep",bkptno="1",syscall-number="1",syscall-name="write",frame={...},...
+	{stopRecord(map[string]interface{}{"reason": "syscall-entry", "disp": "keep", "bkptno": "1",
+		"syscall-number": "1", "syscall-name": "write"}), "",
+		&catchEvent{Number: "1", Kind: "syscall-entry", SyscallNumber: "1", SyscallName: "write", ThreadId: "1", Frame: catchFrame}},
+	{stopRecord(map[string]interface{}{"reason": "syscall-return", "disp": "keep", "bkptno": "1",
+		"syscall-number": "1", "syscall-name": "write"}), "",
+		&catchEvent{Number: "1", Kind: "syscall-return", SyscallNumber: "1", SyscallName: "write", ThreadId: "1", Frame: catchFrame}},
+	// *stopped,reason="fork",disp="keep",bkptno="2",newpid="4321",frame={...},...
+	{stopRecord(map[string]interface{}{"reason": "fork", "disp": "keep", "bkptno": "2", "newpid": "4321"}), "",
+		&catchEvent{Number: "2", Kind: "fork", NewPid: "4321", ThreadId: "1", Frame: catchFrame}},
+	// *stopped,reason="exec",disp="keep",bkptno="3",new-exec="/bin/true",frame={...},...
+	{stopRecord(map[string]interface{}{"reason": "exec", "disp": "keep", "bkptno": "3", "new-exec": "/bin/true"}), "",
+		&catchEvent{Number: "3", Kind: "exec", NewExec: "/bin/true", ThreadId: "1", Frame: catchFrame}},
+	// ~"\nCatchpoint 4 (signal SIGUSR1), "
+	// *stopped,frame={...},thread-id="1",stopped-threads="all",core="3"
+	{stopRecord(nil), "\nCatchpoint 4 (signal SIGUSR1), ",
+		&catchEvent{Number: "4", Kind: "signal", Signal: "SIGUSR1", ThreadId: "1", Frame: catchFrame}},
+	// Signals that gdb stops for by itself have no catchpoint
+	// *stopped,reason="signal-received",signal-name="SIGUSR1",signal-meaning="User defined signal 1",frame={...},...
+	{stopRecord(map[string]interface{}{"reason": "signal-received", "signal-name": "SIGUSR1",
+		"signal-meaning": "User defined signal 1"}), "", nil},
+	{stopRecord(map[string]interface{}{"reason": "breakpoint-hit", "disp": "keep", "bkptno": "5"}), "", nil},
+	{stopRecord(nil), "", nil},
+	{gdblib.AsyncResultRecord{Indication: "running", Result: map[string]interface{}{"thread-id": "all"}},
+		"\nCatchpoint 4 (signal SIGUSR1), ", nil},
+}
+
+func TestCatchStop(t *testing.T) {
+	for _, tt := range catchStopTests {
+		event, ok := catchStop(tt.record, tt.consoleLine)
+		if ok != (tt.event != nil) || !reflect.DeepEqual(event, tt.event) {
+			t.Errorf("catchStop(%v, %q) = %+v, %v; want %+v", tt.record.Result, tt.consoleLine, event, ok, tt.event)
+		}
+	}
+}
+
+var newCatchpointTests = []struct {
+	before []string
+	after  []string
+	number string
+}{
+	{[]string{}, []string{"1"}, "1"},
+	{[]string{"2", "5"}, []string{"2", "5", "7"}, "7"},
+	// Another client set one too
+	{[]string{"2"}, []string{"2", "9", "8"}, "8"},
+	// The command failed without saying so
+	{[]string{"2", "5"}, []string{"2", "5"}, ""},
+	{[]string{}, []string{}, ""},
+}
+
+func TestNewCatchpoint(t *testing.T) {
+	for _, tt := range newCatchpointTests {
+		if number := newCatchpoint(tt.before, tt.after); number != tt.number {
+			t.Errorf("newCatchpoint(%v, %v) = %q, want %q", tt.before, tt.after, number, tt.number)
+		}
+	}
+}
@@ -0,0 +1,771 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirnewton01/godbg/gdblib"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Debug Adapter Protocol messages. Only the fields that godbg uses are
+// declared here.
+
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Command    string      `json:"command"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type dapStackFrame struct {
+	Id     int        `json:"id"`
+	Name   string     `json:"name"`
+	Source *dapSource `json:"source,omitempty"`
+	Line   int        `json:"line"`
+	Column int        `json:"column"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type dapBreakpoint struct {
+	Id       int    `json:"id,omitempty"`
+	Verified bool   `json:"verified"`
+	Message  string `json:"message,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// Variable references handed out to the client. They are only valid
+// until the target resumes.
+
+type dapFrameRef struct {
+	thread string
+	level  string
+}
+
+type dapVarRef struct {
+	// Either the name of an existing variable object or an expression
+	//  to create one from.
+	varobj     string
+	expression string
+	// Where to evaluate the expression
+	thread string
+	level  string
+}
+
+// dapServer translates Debug Adapter Protocol requests onto the gdb
+// session. Clients connect one at a time; the gdb session outlives them
+// just like it does for the web UI.
+type dapServer struct {
+	mysession *session
+	mygdb     Debugger
+
+	// Closed once the first client has finished configuring the session
+	configured     chan bool
+	configuredOnce sync.Once
+
+	// gdb breakpoint numbers set on behalf of the client keyed by source
+	bpMutex     sync.Mutex
+	breakpoints map[string][]string
+}
+
+func newDapServer(mysession *session) *dapServer {
+	return &dapServer{mysession: mysession, mygdb: mysession.mygdb,
+		configured: make(chan bool), breakpoints: make(map[string][]string)}
+}
+
+// dapStdout carries the protocol when serving on stdio. It is kept aside
+// from os.Stdout so that nothing else printed can break the framing of
+// the messages.
+var dapStdout = os.Stdout
+
+// reserveStdout leaves stdout to the protocol. Anything else written to
+// it goes to stderr instead.
+func reserveStdout() {
+	os.Stdout = os.Stderr
+}
+
+// listen serves DAP clients on stdio if addr is "stdio" or on a TCP
+// address otherwise.
+func (server *dapServer) listen(addr string) {
+	if addr == "stdio" {
+		server.serve(os.Stdin, dapStdout, true)
+		return
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "DAP server listening on %v\n", listener.Addr().String())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			panic(err)
+		}
+
+		server.serve(conn, conn, false)
+		conn.Close()
+	}
+}
+
+type dapConn struct {
+	server *dapServer
+	mygdb  Debugger
+	reader *bufio.Reader
+
+	writeMutex sync.Mutex
+	writer     io.Writer
+	seq        int
+
+	mutex   sync.Mutex
+	handles []interface{}
+	varobjs []string
+
+	// Exiting the client on stdio ends the whole debug session
+	owner bool
+}
+
+func (server *dapServer) serve(r io.Reader, w io.Writer, owner bool) {
+	server.mysession.connect()
+	defer server.mysession.disconnect()
+
+	c := &dapConn{server: server, mygdb: server.mygdb, reader: bufio.NewReader(r), writer: w, owner: owner}
+
+	sub, _, _ := server.mysession.hub.subscribe(0)
+	defer server.mysession.hub.unsubscribe(sub)
+
+	go func() {
+		for event := range sub.events {
+			c.handleEvent(event)
+		}
+	}()
+
+	for {
+		req, err := c.readRequest()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "DAP client error: %v\n", err)
+			}
+			if owner {
+				server.mygdb.Exit()
+			}
+			return
+		}
+
+		body, err := c.dispatch(req)
+
+		resp := &dapResponse{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		c.send(resp)
+
+		switch req.Command {
+		case "initialize":
+			// The client may now send its breakpoints
+			c.sendEvent("initialized", nil)
+		case "disconnect":
+			return
+		}
+	}
+}
+
+func (c *dapConn) readRequest() (*dapRequest, error) {
+	length := -1
+
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if strings.HasPrefix(line, "Content-Length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len("Content-Length:"):]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, errors.New("Missing Content-Length header")
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(c.reader, content)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &dapRequest{}
+	err = json.Unmarshal(content, req)
+	return req, err
+}
+
+func (c *dapConn) send(msg interface{}) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.seq++
+	switch m := msg.(type) {
+	case *dapResponse:
+		m.Seq = c.seq
+	case *dapEvent:
+		m.Seq = c.seq
+	}
+
+	bytes, err := json.Marshal(msg)
+	if err != nil {
+		// TODO log the marshalling error
+		return
+	}
+
+	fmt.Fprintf(c.writer, "Content-Length: %v\r\n\r\n", len(bytes))
+	c.writer.Write(bytes)
+}
+
+func (c *dapConn) sendEvent(event string, body interface{}) {
+	c.send(&dapEvent{Type: "event", Event: event, Body: body})
+}
+
+// handleEvent translates a session event into DAP events.
+func (c *dapConn) handleEvent(event webSockResult) {
+	switch event.Type {
+	case "console", "gdb":
+		c.sendEvent("output", map[string]interface{}{"category": "console", "output": event.Data})
+	case "target":
+		c.sendEvent("output", map[string]interface{}{"category": "stdout", "output": event.Data})
+	case "logpoint":
+		if lp, ok := event.Data.(logpointEvent); ok {
+			c.sendEvent("output", map[string]interface{}{"category": "console", "output": lp.Message + "\n"})
+		}
+	case "async":
+		record, ok := event.Data.(gdblib.AsyncResultRecord)
+		if !ok {
+			return
+		}
+
+		reason, _ := record.Result["reason"].(string)
+		threadId, _ := strconv.Atoi(fmt.Sprint(record.Result["thread-id"]))
+
+		switch {
+		case record.Indication == "running":
+			c.resetHandles()
+			c.sendEvent("continued", map[string]interface{}{"threadId": threadId, "allThreadsContinued": true})
+		case record.Indication == "stopped" && strings.HasPrefix(reason, "exited"):
+			exitCode, _ := strconv.ParseInt(fmt.Sprint(record.Result["exit-code"]), 8, 32)
+			c.sendEvent("exited", map[string]interface{}{"exitCode": exitCode})
+			c.sendEvent("terminated", nil)
+		case record.Indication == "stopped":
+			c.resetHandles()
+
+			body := map[string]interface{}{"reason": dapStopReason(reason),
+				"threadId": threadId, "allThreadsStopped": true}
+			if function, ok := c.server.mysession.panicStop(record); ok {
+				body["reason"] = "exception"
+				body["description"] = "Stopped in " + function
+			}
+			c.sendEvent("stopped", body)
+		}
+	case "panic":
+		if p, ok := event.Data.(panicEvent); ok {
+			c.sendEvent("output", map[string]interface{}{"category": "stderr", "output": "panic: " + p.Value + "\n"})
+		}
+	}
+}
+
+func dapStopReason(reason string) string {
+	switch reason {
+	case "breakpoint-hit":
+		return "breakpoint"
+	case "end-stepping-range", "function-finished":
+		return "step"
+	case "signal-received":
+		return "pause"
+	}
+	return reason
+}
+
+// handle hands out a new reference for the client to use in later
+// requests. Zero is reserved by the protocol so references start at one.
+func (c *dapConn) handle(ref interface{}) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.handles = append(c.handles, ref)
+	return len(c.handles)
+}
+
+func (c *dapConn) lookup(id int) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if id < 1 || id > len(c.handles) {
+		return nil
+	}
+	return c.handles[id-1]
+}
+
+// replace points a reference at something else as long as it still
+// refers to what it did.
+func (c *dapConn) replace(id int, old interface{}, ref interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if id >= 1 && id <= len(c.handles) && c.handles[id-1] == old {
+		c.handles[id-1] = ref
+	}
+}
+
+// resetHandles invalidates all references once the target moves on and
+// drops the variable objects created to serve them.
+func (c *dapConn) resetHandles() {
+	c.mutex.Lock()
+	varobjs := c.varobjs
+	c.handles = nil
+	c.varobjs = nil
+	c.mutex.Unlock()
+
+	for _, name := range varobjs {
+		c.mygdb.VarDelete(gdblib.VarDeleteParms{Name: name})
+	}
+}
+
+func (c *dapConn) dispatch(req *dapRequest) (interface{}, error) {
+	switch req.Command {
+	case "next", "stepIn", "stepOut", "continue", "pause":
+		if c.server.mysession.readOnly {
+			return nil, errors.New("Execution control is disabled in a read-only session")
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest":  true,
+			"supportsEvaluateForHovers":         true,
+			"supportsConditionalBreakpoints":    true,
+			"supportsHitConditionalBreakpoints": true,
+			"supportsLogPoints":                 true,
+			"supportsSteppingGranularity":       true,
+		}, nil
+	case "launch", "attach":
+		// The program was already handed to godbg on the command line
+		return nil, nil
+	case "configurationDone":
+		c.server.configuredOnce.Do(func() { close(c.server.configured) })
+		return nil, nil
+	case "disconnect":
+		args := struct {
+			TerminateDebuggee bool `json:"terminateDebuggee"`
+		}{}
+		json.Unmarshal(req.Arguments, &args)
+
+		if c.owner || args.TerminateDebuggee {
+			c.mygdb.Exit()
+		}
+		return nil, nil
+	case "setBreakpoints":
+		return c.setBreakpoints(req.Arguments)
+	case "threads":
+		return c.threads()
+	case "stackTrace":
+		return c.stackTrace(req.Arguments)
+	case "scopes":
+		return c.scopes(req.Arguments)
+	case "variables":
+		return c.variables(req.Arguments)
+	case "evaluate":
+		return c.evaluate(req.Arguments)
+	case "next", "stepIn", "stepOut", "continue":
+		args := struct {
+			ThreadId    int    `json:"threadId"`
+			Granularity string `json:"granularity"`
+		}{}
+		err := json.Unmarshal(req.Arguments, &args)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = c.mygdb.ThreadSelect(gdblib.ThreadSelectParms{ThreadId: strconv.Itoa(args.ThreadId)})
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case req.Command == "next" && args.Granularity == "instruction":
+			return nil, c.mygdb.ExecNextInstruction(gdblib.ExecNextInstructionParms{})
+		case req.Command == "stepIn" && args.Granularity == "instruction":
+			return nil, c.mygdb.ExecStepInstruction(gdblib.ExecStepInstructionParms{})
+		}
+
+		switch req.Command {
+		case "next":
+			return nil, c.mygdb.ExecNext(gdblib.ExecNextParms{})
+		case "stepIn":
+			return nil, c.mygdb.ExecStep(gdblib.ExecStepParms{})
+		case "stepOut":
+			return nil, c.mygdb.ExecFinish(gdblib.ExecFinishParms{})
+		}
+		return map[string]interface{}{"allThreadsContinued": true}, c.mygdb.ExecContinue(gdblib.ExecContinueParms{})
+	case "pause":
+		return nil, c.mygdb.ExecInterrupt(gdblib.ExecInterruptParms{})
+	}
+
+	return nil, errors.New("Unsupported request: " + req.Command)
+}
+
+func (c *dapConn) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	args := struct {
+		Source      dapSource `json:"source"`
+		Breakpoints []struct {
+			Line         int    `json:"line"`
+			Condition    string `json:"condition"`
+			HitCondition string `json:"hitCondition"`
+			LogMessage   string `json:"logMessage"`
+		} `json:"breakpoints"`
+	}{}
+	err := json.Unmarshal(arguments, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	server := c.server
+	server.bpMutex.Lock()
+	defer server.bpMutex.Unlock()
+
+	// The request replaces every breakpoint in the source
+	if old := server.breakpoints[args.Source.Path]; len(old) > 0 {
+		c.mygdb.BreakDelete(gdblib.BreakDeleteParms{Breakpoints: old})
+		server.mysession.logpoints.remove(old)
+	}
+
+	numbers := []string{}
+	breakpoints := []dapBreakpoint{}
+
+	for _, bp := range args.Breakpoints {
+		parms := gdblib.BreakInsertParms{Location: args.Source.Path + ":" + strconv.Itoa(bp.Line), Condition: bp.Condition}
+
+		// A hit condition of N stops on the Nth hit, so the first N-1 are ignored
+		if bp.HitCondition != "" {
+			hits, err := strconv.Atoi(strings.TrimSpace(bp.HitCondition))
+			if err != nil || hits < 1 {
+				breakpoints = append(breakpoints, dapBreakpoint{Verified: false, Message: "Unsupported hit condition " + bp.HitCondition, Line: bp.Line})
+				continue
+			}
+			parms.IgnoreCount = hits - 1
+		}
+
+		// Log messages use the same {expression} syntax as logpoints
+		if bp.LogMessage != "" {
+			_, err := parseLogFormat(bp.LogMessage)
+			if err != nil {
+				breakpoints = append(breakpoints, dapBreakpoint{Verified: false, Message: err.Error(), Line: bp.Line})
+				continue
+			}
+		}
+
+		result, err := c.mygdb.BreakInsert(parms)
+		if err != nil {
+			breakpoints = append(breakpoints, dapBreakpoint{Verified: false, Message: err.Error(), Line: bp.Line})
+			continue
+		}
+
+		inserted := miBreakInsert{}
+		remarshal(result, &inserted)
+
+		id, _ := strconv.Atoi(inserted.Bkpt.Number)
+		line, err := strconv.Atoi(inserted.Bkpt.Line)
+		if err != nil {
+			line = bp.Line
+		}
+
+		if bp.LogMessage != "" {
+			server.mysession.logpoints.add(inserted.Bkpt.Number, bp.LogMessage)
+		}
+
+		numbers = append(numbers, inserted.Bkpt.Number)
+		breakpoints = append(breakpoints, dapBreakpoint{Id: id, Verified: true, Line: line})
+	}
+
+	server.breakpoints[args.Source.Path] = numbers
+
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+func (c *dapConn) threads() (interface{}, error) {
+	result, err := c.mygdb.ThreadInfo(gdblib.ThreadInfoParms{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := miThreads{}
+	err = remarshal(result, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := []map[string]interface{}{}
+	for _, thread := range info.Threads {
+		id, _ := strconv.Atoi(thread.Id)
+		name := thread.Name
+		if name == "" {
+			name = thread.TargetId
+		}
+		threads = append(threads, map[string]interface{}{"id": id, "name": name})
+	}
+
+	return map[string]interface{}{"threads": threads}, nil
+}
+
+func (c *dapConn) stackTrace(arguments json.RawMessage) (interface{}, error) {
+	args := struct {
+		ThreadId int `json:"threadId"`
+	}{}
+	err := json.Unmarshal(arguments, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := strconv.Itoa(args.ThreadId)
+	result, err := c.mygdb.StackListFrames(gdblib.StackListFramesParms{ThreadId: thread})
+	if err != nil {
+		return nil, err
+	}
+
+	stack := miStack{}
+	err = remarshal(result, &stack)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := []dapStackFrame{}
+	for _, frame := range stack.Stack {
+		dapFrame := dapStackFrame{Id: c.handle(dapFrameRef{thread: thread, level: frame.Level}), Name: frame.Func}
+		dapFrame.Line, _ = strconv.Atoi(frame.Line)
+
+		if frame.Fullname != "" || frame.File != "" {
+			path := frame.Fullname
+			if path == "" {
+				path = frame.File
+			}
+			dapFrame.Source = &dapSource{Name: frame.File, Path: path}
+		}
+
+		frames = append(frames, dapFrame)
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (c *dapConn) scopes(arguments json.RawMessage) (interface{}, error) {
+	args := struct {
+		FrameId int `json:"frameId"`
+	}{}
+	err := json.Unmarshal(arguments, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	frame, ok := c.lookup(args.FrameId).(dapFrameRef)
+	if !ok {
+		return nil, errors.New("Unknown frame")
+	}
+
+	scope := map[string]interface{}{"name": "Locals", "variablesReference": c.handle(frame), "expensive": false}
+	return map[string]interface{}{"scopes": []interface{}{scope}}, nil
+}
+
+func (c *dapConn) variables(arguments json.RawMessage) (interface{}, error) {
+	args := struct {
+		VariablesReference int `json:"variablesReference"`
+		Start              int `json:"start"`
+		Count              int `json:"count"`
+	}{}
+	err := json.Unmarshal(arguments, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := []dapVariable{}
+
+	switch ref := c.lookup(args.VariablesReference).(type) {
+	case dapFrameRef:
+		result, err := c.mygdb.StackListVariables(gdblib.StackListVariablesParms{Thread: ref.thread, Frame: ref.level, AllValues: true})
+		if err != nil {
+			return nil, err
+		}
+
+		locals := miVariables{}
+		err = remarshal(result, &locals)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, local := range locals.Variables {
+			variable := dapVariable{Name: local.Name, Value: local.Value, Type: local.Type}
+
+			// Only aggregates and pointers are worth expanding
+			if strings.HasPrefix(local.Value, "{") || strings.HasPrefix(local.Value, "[") || strings.HasPrefix(local.Value, "0x") {
+				variable.VariablesReference = c.handle(dapVarRef{expression: local.Name, thread: ref.thread, level: ref.level})
+			}
+
+			variables = append(variables, variable)
+		}
+	case dapVarRef:
+		if ref.varobj == "" {
+			created, err := c.createVarobj(ref.expression, ref.thread, ref.level)
+			if err != nil {
+				return nil, err
+			}
+
+			// Expanding it again reuses the variable object
+			expression := ref
+			ref.varobj = created.Name
+			c.replace(args.VariablesReference, expression, ref)
+		}
+
+		// Children are listed a page at a time, a huge slice or map
+		//  would keep the debugger busy for good
+		if args.Count <= 0 || args.Count > maxChildrenListed {
+			args.Count = childrenPageSize
+		}
+
+		result, err := c.mygdb.VarListChildren(gdblib.VarListChildrenParms{Name: ref.varobj, AllValues: true,
+			From: args.Start, To: args.Start + args.Count})
+		if err != nil {
+			return nil, err
+		}
+
+		children := miChildren{}
+		err = remarshal(result, &children)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, child := range children.Children {
+			name := child.Exp
+			if name == "" {
+				name = child.Name
+			}
+
+			variable := dapVariable{Name: name, Value: child.Value, Type: child.Type}
+			if child.Numchild != "" && child.Numchild != "0" {
+				variable.VariablesReference = c.handle(dapVarRef{varobj: child.Name, thread: ref.thread, level: ref.level})
+			}
+
+			variables = append(variables, variable)
+		}
+	default:
+		return nil, errors.New("Unknown variables reference")
+	}
+
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+func (c *dapConn) evaluate(arguments json.RawMessage) (interface{}, error) {
+	args := struct {
+		Expression string `json:"expression"`
+		FrameId    int    `json:"frameId"`
+	}{}
+	err := json.Unmarshal(arguments, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	thread, level := "", ""
+	if frame, ok := c.lookup(args.FrameId).(dapFrameRef); ok {
+		thread, level = frame.thread, frame.level
+	}
+
+	created, err := c.createVarobj(args.Expression, thread, level)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"result": created.Value, "type": created.Type, "variablesReference": 0}
+	if created.Numchild != "" && created.Numchild != "0" {
+		body["variablesReference"] = c.handle(dapVarRef{varobj: created.Name, thread: thread, level: level})
+	}
+
+	return body, nil
+}
+
+// createVarobj creates a variable object in a frame of the given thread,
+// the selected one if either is empty, and remembers it so that it is
+// deleted when the target resumes.
+func (c *dapConn) createVarobj(expression string, thread string, level string) (*miVariable, error) {
+	if thread != "" {
+		_, err := c.mygdb.ThreadSelect(gdblib.ThreadSelectParms{ThreadId: thread})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if level != "" {
+		err := c.mygdb.StackSelectFrame(gdblib.StackSelectFrameParms{Frame: level})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := c.mygdb.VarCreate(gdblib.VarCreateParms{Expression: expression})
+	if err != nil {
+		return nil, err
+	}
+
+	created := &miVariable{}
+	err = remarshal(result, created)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.varobjs = append(c.varobjs, created.Name)
+	c.mutex.Unlock()
+
+	return created, nil
+}
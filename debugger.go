@@ -0,0 +1,293 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"strconv"
+	"strings"
+)
+
+// Debugger is implemented by each of the debugger backends that godbg
+// can drive. The parameters and events follow the gdb machine interface
+// since that is what the web UI was built on. Results are marshalled
+// as-is to the client so they should have the same JSON form as the
+// corresponding gdblib result.
+type Debugger interface {
+	// Execution control
+	// ExecArgs sets the arguments of the program for the next run. Each
+	//  backend passes them along in its own way so they are not quoted.
+	ExecArgs(args []string) error
+	ExecRun(parms gdblib.ExecRunParms) error
+	ExecNext(parms gdblib.ExecNextParms) error
+	ExecStep(parms gdblib.ExecStepParms) error
+	ExecNextInstruction(parms gdblib.ExecNextInstructionParms) error
+	ExecStepInstruction(parms gdblib.ExecStepInstructionParms) error
+	ExecContinue(parms gdblib.ExecContinueParms) error
+	ExecInterrupt(parms gdblib.ExecInterruptParms) error
+	ExecFinish(parms gdblib.ExecFinishParms) error
+	ExecUntil(parms gdblib.ExecUntilParms) error
+	ExecJump(parms gdblib.ExecJumpParms) error
+	// ExecReturn pops the current frame without a stopped record so the
+	// result is the new frame
+	ExecReturn(parms gdblib.ExecReturnParms) (interface{}, error)
+
+	// Breakpoints
+	BreakList() (interface{}, error)
+	BreakInsert(parms gdblib.BreakInsertParms) (interface{}, error)
+	BreakWatch(parms gdblib.BreakWatchParms) (interface{}, error)
+	BreakEnable(parms gdblib.BreakEnableParms) error
+	BreakDisable(parms gdblib.BreakDisableParms) error
+	BreakDelete(parms gdblib.BreakDeleteParms) error
+	BreakCondition(parms gdblib.BreakConditionParms) error
+	BreakAfter(parms gdblib.BreakAfterParms) error
+
+	// Threads
+	ThreadListIds() (interface{}, error)
+	ThreadSelect(parms gdblib.ThreadSelectParms) (interface{}, error)
+	ThreadInfo(parms gdblib.ThreadInfoParms) (interface{}, error)
+
+	// Frames
+	StackInfoFrame() (interface{}, error)
+	StackListFrames(parms gdblib.StackListFramesParms) (interface{}, error)
+	StackListVariables(parms gdblib.StackListVariablesParms) (interface{}, error)
+	StackSelectFrame(parms gdblib.StackSelectFrameParms) error
+
+	// Machine code
+	DataDisassemble(parms gdblib.DataDisassembleParms) (interface{}, error)
+	DataListRegisterNames() (interface{}, error)
+	DataListRegisterValues(parms gdblib.DataListRegisterValuesParms) (interface{}, error)
+	// DataListChangedRegisters gives the registers that changed since the
+	//  program last stopped
+	DataListChangedRegisters() (interface{}, error)
+	DataReadMemoryBytes(parms gdblib.DataReadMemoryBytesParms) (interface{}, error)
+	DataWriteMemoryBytes(parms gdblib.DataWriteMemoryBytesParms) error
+
+	// Variable objects
+	VarCreate(parms gdblib.VarCreateParms) (interface{}, error)
+	VarDelete(parms gdblib.VarDeleteParms) error
+	VarListChildren(parms gdblib.VarListChildrenParms) (interface{}, error)
+	VarInfoNumChildren(parms gdblib.VarInfoNumChildrenParms) (interface{}, error)
+	VarInfoType(parms gdblib.VarInfoTypeParms) (interface{}, error)
+	VarAssign(parms gdblib.VarAssignParms) (interface{}, error)
+	VarUpdate(parms gdblib.VarUpdateParms) (interface{}, error)
+	VarSetFormat(parms gdblib.VarSetFormatParms) (interface{}, error)
+	// VarSetVisualizer turns the pretty printer of a variable object off
+	//  with the visualizer None
+	VarSetVisualizer(parms gdblib.VarSetVisualizerParms) error
+
+	// Event streams
+	ConsoleLines() <-chan string
+	TargetLines() <-chan string
+	LogLines() <-chan string
+	AsyncRecords() <-chan gdblib.AsyncResultRecord
+
+	// Exit ends the debug session along with the target and Wait blocks
+	//  until it is over.
+	Exit()
+	Wait() error
+}
+
+// debugTarget describes what a debugger backend is asked to debug.
+type debugTarget struct {
+	execPath string
+	srcDir   string
+
+	// Attach to this running process instead of launching execPath
+	pid int
+	// Examine this core dump of execPath instead of launching it
+	corePath string
+}
+
+// launches reports whether the target program still needs to be run.
+func (target debugTarget) launches() bool {
+	return target.pid == 0 && target.corePath == ""
+}
+
+func newDebugger(backend string, target debugTarget) (Debugger, error) {
+	switch backend {
+	case "gdb":
+		mygdb, err := gdblib.NewGDB(target.execPath, target.srcDir)
+		if err != nil {
+			return nil, err
+		}
+
+		d := gdbDebugger{mygdb}
+		switch {
+		case target.pid != 0:
+			err = d.Attach(target.pid)
+		case target.corePath != "":
+			err = d.GDB.TargetSelect(gdblib.TargetSelectParms{Type: "core", Parameters: target.corePath})
+		}
+		if err != nil {
+			d.Exit()
+			return nil, err
+		}
+		return d, nil
+	case "dlv":
+		switch {
+		case target.pid != 0:
+			return newDelveDebugger([]string{"attach", strconv.Itoa(target.pid), target.execPath}, target.srcDir)
+		case target.corePath != "":
+			return newDelveDebugger([]string{"core", target.execPath, target.corePath}, target.srcDir)
+		}
+		return newDelveDebugger([]string{"exec", target.execPath}, target.srcDir)
+	}
+
+	return nil, errors.New("Unknown debugger backend: " + backend)
+}
+
+// gdbDebugger is the Debugger backed by gdb through gdblib.
+type gdbDebugger struct {
+	*gdblib.GDB
+}
+
+// ExecArgs quotes the arguments for the shell that gdb starts the program
+// with.
+func (d gdbDebugger) ExecArgs(args []string) error {
+	quoted := make([]string, len(args))
+	for idx, arg := range args {
+		quoted[idx] = shellQuote(arg)
+	}
+	return d.GDB.ExecArgs(gdblib.ExecArgsParms{Args: strings.Join(quoted, " ")})
+}
+
+// shellQuote protects an argument from the shell.
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func (d gdbDebugger) ExecReturn(parms gdblib.ExecReturnParms) (interface{}, error) {
+	return d.GDB.ExecReturn(parms)
+}
+
+func (d gdbDebugger) BreakList() (interface{}, error) {
+	return d.GDB.BreakList()
+}
+
+func (d gdbDebugger) BreakInsert(parms gdblib.BreakInsertParms) (interface{}, error) {
+	return d.GDB.BreakInsert(parms)
+}
+
+func (d gdbDebugger) BreakWatch(parms gdblib.BreakWatchParms) (interface{}, error) {
+	expression, err := d.watchExpression(parms.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parms.Expression = expression
+	return d.GDB.BreakWatch(parms)
+}
+
+func (d gdbDebugger) ThreadListIds() (interface{}, error) {
+	return d.GDB.ThreadListIds()
+}
+
+func (d gdbDebugger) ThreadSelect(parms gdblib.ThreadSelectParms) (interface{}, error) {
+	return d.GDB.ThreadSelect(parms)
+}
+
+func (d gdbDebugger) ThreadInfo(parms gdblib.ThreadInfoParms) (interface{}, error) {
+	return d.GDB.ThreadInfo(parms)
+}
+
+func (d gdbDebugger) StackInfoFrame() (interface{}, error) {
+	return d.GDB.StackInfoFrame()
+}
+
+func (d gdbDebugger) StackListFrames(parms gdblib.StackListFramesParms) (interface{}, error) {
+	return d.GDB.StackListFrames(parms)
+}
+
+func (d gdbDebugger) StackListVariables(parms gdblib.StackListVariablesParms) (interface{}, error) {
+	return d.GDB.StackListVariables(parms)
+}
+
+func (d gdbDebugger) StackSelectFrame(parms gdblib.StackSelectFrameParms) error {
+	return d.GDB.StackSelectFrame(parms)
+}
+
+func (d gdbDebugger) DataDisassemble(parms gdblib.DataDisassembleParms) (interface{}, error) {
+	return d.GDB.DataDisassemble(parms)
+}
+
+func (d gdbDebugger) DataListRegisterNames() (interface{}, error) {
+	return d.GDB.DataListRegisterNames()
+}
+
+func (d gdbDebugger) DataListRegisterValues(parms gdblib.DataListRegisterValuesParms) (interface{}, error) {
+	return d.GDB.DataListRegisterValues(parms)
+}
+
+func (d gdbDebugger) DataListChangedRegisters() (interface{}, error) {
+	return d.GDB.DataListChangedRegisters()
+}
+
+func (d gdbDebugger) DataReadMemoryBytes(parms gdblib.DataReadMemoryBytesParms) (interface{}, error) {
+	return d.GDB.DataReadMemoryBytes(parms)
+}
+
+func (d gdbDebugger) VarCreate(parms gdblib.VarCreateParms) (interface{}, error) {
+	return d.GDB.VarCreate(parms)
+}
+
+func (d gdbDebugger) VarListChildren(parms gdblib.VarListChildrenParms) (interface{}, error) {
+	return d.GDB.VarListChildren(parms)
+}
+
+func (d gdbDebugger) VarInfoNumChildren(parms gdblib.VarInfoNumChildrenParms) (interface{}, error) {
+	return d.GDB.VarInfoNumChildren(parms)
+}
+
+func (d gdbDebugger) VarInfoType(parms gdblib.VarInfoTypeParms) (interface{}, error) {
+	return d.GDB.VarInfoType(parms)
+}
+
+func (d gdbDebugger) VarAssign(parms gdblib.VarAssignParms) (interface{}, error) {
+	return d.GDB.VarAssign(parms)
+}
+
+func (d gdbDebugger) VarUpdate(parms gdblib.VarUpdateParms) (interface{}, error) {
+	return d.GDB.VarUpdate(parms)
+}
+
+func (d gdbDebugger) VarSetFormat(parms gdblib.VarSetFormatParms) (interface{}, error) {
+	return d.GDB.VarSetFormat(parms)
+}
+
+func (d gdbDebugger) ConsoleLines() <-chan string {
+	return d.GDB.Console
+}
+
+func (d gdbDebugger) TargetLines() <-chan string {
+	return d.GDB.Target
+}
+
+func (d gdbDebugger) LogLines() <-chan string {
+	return d.GDB.InternalLog
+}
+
+func (d gdbDebugger) AsyncRecords() <-chan gdblib.AsyncResultRecord {
+	return d.GDB.AsyncResults
+}
+
+func (d gdbDebugger) Exit() {
+	d.GDB.GdbExit()
+}
+
+func (d gdbDebugger) Attach(pid int) error {
+	return d.GDB.TargetAttach(gdblib.TargetAttachParms{Pid: strconv.Itoa(pid)})
+}
+
+// Detach lets the process carry on running without the debugger.
+func (d gdbDebugger) Detach() error {
+	return d.GDB.TargetDetach(gdblib.TargetDetachParms{})
+}
+
+// console runs a gdb command that has no MI equivalent.
+func (d gdbDebugger) console(command string) error {
+	return d.GDB.InterpreterExec(gdblib.InterpreterExecParms{Interpreter: "console", Command: command})
+}
@@ -0,0 +1,1408 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/sirnewton01/godbg/gdblib"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The following types mirror the parts of the Delve JSON-RPC (API v2)
+// that godbg uses.
+
+type dlvFunction struct {
+	Name string `json:"name"`
+	// Entry address
+	Value uint64 `json:"value"`
+}
+
+type dlvLocation struct {
+	PC       uint64       `json:"pc"`
+	File     string       `json:"file"`
+	Line     int          `json:"line"`
+	Function *dlvFunction `json:"function,omitempty"`
+}
+
+type dlvGoroutine struct {
+	ID             int64       `json:"id"`
+	CurrentLoc     dlvLocation `json:"currentLoc"`
+	UserCurrentLoc dlvLocation `json:"userCurrentLoc"`
+	ThreadID       int         `json:"threadID"`
+}
+
+type dlvBreakpoint struct {
+	ID            int    `json:"id"`
+	Addr          uint64 `json:"addr"`
+	File          string `json:"file"`
+	Line          int    `json:"line"`
+	FunctionName  string `json:"functionName,omitempty"`
+	Cond          string `json:"Cond"`
+	HitCond       string `json:"hitCond"`
+	TotalHitCount uint64 `json:"totalHitCount"`
+	Disabled      bool   `json:"disabled"`
+	WatchExpr     string `json:"WatchExpr,omitempty"`
+	WatchType     int    `json:"WatchType,omitempty"`
+}
+
+type dlvInstruction struct {
+	Loc   dlvLocation
+	Text  string
+	Bytes []byte
+}
+
+type dlvRegister struct {
+	Name  string
+	Value string
+}
+
+type dlvThread struct {
+	ID          int            `json:"id"`
+	GoroutineID int64          `json:"goroutineID"`
+	Breakpoint  *dlvBreakpoint `json:"breakPoint,omitempty"`
+	// Only filled in after stepping out of a function
+	ReturnValues []dlvVariable `json:"ReturnValues"`
+}
+
+type dlvState struct {
+	Running           bool          `json:"Running"`
+	CurrentThread     *dlvThread    `json:"currentThread,omitempty"`
+	SelectedGoroutine *dlvGoroutine `json:"currentGoroutine,omitempty"`
+	Exited            bool          `json:"exited"`
+	ExitStatus        int           `json:"exitStatus"`
+}
+
+type dlvVariable struct {
+	Name       string        `json:"name"`
+	Type       string        `json:"type"`
+	Kind       int           `json:"kind"`
+	Addr       uint64        `json:"addr"`
+	Base       uint64        `json:"base"`
+	Cap        int64         `json:"cap"`
+	Value      string        `json:"value"`
+	Len        int64         `json:"len"`
+	Children   []dlvVariable `json:"children"`
+	Unreadable string        `json:"unreadable"`
+}
+
+type dlvEvalScope struct {
+	GoroutineID int64
+	Frame       int
+}
+
+type dlvLoadConfig struct {
+	FollowPointers     bool
+	MaxVariableRecurse int
+	MaxStringLen       int
+	MaxArrayValues     int
+	MaxStructFields    int
+}
+
+// Values of reflect.Kind as reported by Delve
+const (
+	dlvKindArray     = 17
+	dlvKindInterface = 20
+	dlvKindMap       = 21
+	dlvKindPtr       = 22
+	dlvKindSlice     = 23
+	dlvKindString    = 24
+	dlvKindStruct    = 25
+	dlvKindUnsafePtr = 26
+)
+
+// Delve's flavour of assembly that matches gdb's default
+const dlvGNUFlavour = 1
+
+// Kinds of Delve watchpoint
+const (
+	dlvWatchRead  = 1 << 0
+	dlvWatchWrite = 1 << 1
+)
+
+var dlvDefaultLoadConfig = dlvLoadConfig{FollowPointers: true, MaxVariableRecurse: 1,
+	MaxStringLen: 1024, MaxArrayValues: 64, MaxStructFields: -1}
+
+// dlvVarobj stands in for a gdb variable object. Children of maps can't
+// be named by an expression so their last loaded value is used instead.
+type dlvVarobj struct {
+	expression string
+	scope      dlvEvalScope
+	value      *dlvVariable
+	// One of gdb's formats or none for natural, raw if the visualizer is off
+	format string
+	raw    bool
+}
+
+// describe gives the value of a variable object in its format. Raw
+// slices and strings are shown as the headers that they are.
+func (varobj *dlvVarobj) describe() string {
+	v := varobj.value
+
+	switch {
+	case varobj.raw && v.Kind == dlvKindString:
+		return fmt.Sprintf("{str = 0x%x, len = %v}", v.Base, v.Len)
+	case varobj.raw && v.Kind == dlvKindSlice:
+		return fmt.Sprintf("{array = 0x%x, len = %v, cap = %v}", v.Base, v.Len, v.Cap)
+	}
+
+	n, err := strconv.ParseInt(v.Value, 10, 64)
+	bits := uint64(n)
+	if err != nil {
+		bits, err = strconv.ParseUint(v.Value, 10, 64)
+	}
+	if err != nil {
+		return dlvValue(v)
+	}
+
+	switch varobj.format {
+	case "hexadecimal":
+		return "0x" + strconv.FormatUint(bits, 16)
+	case "zero-hexadecimal":
+		return fmt.Sprintf("0x%016x", bits)
+	case "octal":
+		return "0" + strconv.FormatUint(bits, 8)
+	case "binary":
+		return strconv.FormatUint(bits, 2)
+	}
+	return dlvValue(v)
+}
+
+// delveDebugger is the Debugger backed by a headless Delve server that
+// it spawns and talks to over JSON-RPC. Goroutines are presented to the
+// client as threads.
+type delveDebugger struct {
+	cmd    *exec.Cmd
+	client *rpc.Client
+	// The target was running before Delve attached to it so it is left
+	//  running when the session is over
+	attached bool
+
+	console chan string
+	target  chan string
+	log     chan string
+	async   chan gdblib.AsyncResultRecord
+
+	mutex     sync.Mutex
+	goroutine int64
+	// Selected frame of the goroutine, the top one after each stop
+	frame     int
+	varobjs   map[string]*dlvVarobj
+	nextVar   int
+	temporary map[int]bool
+	// Last seen value of each watchpoint's expression
+	watched map[int]string
+	// Registers as of the last two stops
+	stopRegisters     []dlvRegister
+	lastStopRegisters []dlvRegister
+}
+
+// newDelveDebugger spawns dlv with the given arguments to launch or attach
+// to the target.
+func newDelveDebugger(dlvArgs []string, srcDir string) (*delveDebugger, error) {
+	dlvPath, err := exec.LookPath("dlv")
+	if err != nil {
+		return nil, errors.New("Could not find dlv on the PATH")
+	}
+
+	d := &delveDebugger{console: make(chan string), target: make(chan string),
+		log: make(chan string), async: make(chan gdblib.AsyncResultRecord),
+		varobjs: make(map[string]*dlvVarobj), temporary: make(map[int]bool),
+		watched: make(map[int]string), attached: dlvArgs[0] == "attach"}
+
+	dlvArgs = append(dlvArgs, "--headless", "--api-version=2", "--accept-multiclient", "--listen=127.0.0.1:0")
+	d.cmd = exec.Command(dlvPath, dlvArgs...)
+	if srcDir != "" {
+		d.cmd.Dir = srcDir
+	}
+
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := d.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = d.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	// Delve announces its address before anything else
+	reader := bufio.NewReader(stdout)
+	addr := ""
+	for addr == "" {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			d.cmd.Process.Kill()
+			return nil, errors.New("Delve exited before it started listening")
+		}
+
+		const prefix = "API server listening at:"
+		if strings.HasPrefix(line, prefix) {
+			addr = strings.TrimSpace(line[len(prefix):])
+		}
+	}
+
+	d.client, err = jsonrpc.Dial("tcp", addr)
+	if err != nil {
+		d.cmd.Process.Kill()
+		return nil, err
+	}
+
+	// The target shares delve's stdout
+	go forwardLines(reader, d.target)
+	go forwardLines(bufio.NewReader(stderr), d.log)
+
+	return d, nil
+}
+
+func forwardLines(reader *bufio.Reader, lines chan string) {
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines <- line
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (d *delveDebugger) call(method string, in interface{}, out interface{}) error {
+	return d.client.Call("RPCServer."+method, in, out)
+}
+
+func (d *delveDebugger) scope() dlvEvalScope {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return dlvEvalScope{GoroutineID: d.goroutine, Frame: d.frame}
+}
+
+// command runs an execution command in the background since Delve only
+// answers once the target stops again. The client sees the same running
+// and stopped records that gdb would give it.
+func (d *delveDebugger) command(name string, stepping bool) error {
+	in := map[string]interface{}{"name": name}
+
+	d.mutex.Lock()
+	if stepping && d.goroutine != 0 {
+		in["goroutineID"] = d.goroutine
+	}
+	d.mutex.Unlock()
+
+	if name == "stepOut" {
+		in["ReturnInfoLoadConfig"] = dlvDefaultLoadConfig
+	}
+
+	// Stepping by instruction can end up inside the runtime
+	instruction := name == "stepInstruction" || name == "nextInstruction"
+
+	go func() {
+		d.async <- gdblib.AsyncResultRecord{Indication: "running",
+			Result: map[string]interface{}{"thread-id": "all"}}
+
+		out := struct{ State dlvState }{}
+		err := d.call("Command", in, &out)
+		if err != nil {
+			d.console <- fmt.Sprintf("%v\n", err)
+		}
+
+		d.mutex.Lock()
+		d.frame = 0
+		d.mutex.Unlock()
+
+		d.async <- d.stoppedRecord(&out.State, stepping, instruction)
+	}()
+
+	return nil
+}
+
+func (d *delveDebugger) stoppedRecord(state *dlvState, stepping bool, instruction bool) gdblib.AsyncResultRecord {
+	result := map[string]interface{}{}
+
+	if state.Exited {
+		result["reason"] = "exited"
+		if state.ExitStatus == 0 {
+			result["reason"] = "exited-normally"
+		}
+		result["exit-code"] = strconv.FormatInt(int64(state.ExitStatus), 8)
+		return gdblib.AsyncResultRecord{Indication: "stopped", Result: result}
+	}
+
+	switch {
+	case state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil && state.CurrentThread.Breakpoint.WatchExpr != "":
+		scope := dlvEvalScope{}
+		if state.SelectedGoroutine != nil {
+			scope.GoroutineID = state.SelectedGoroutine.ID
+		}
+		d.watchpointRecord(state.CurrentThread.Breakpoint, scope, result)
+	case state.CurrentThread != nil && state.CurrentThread.Breakpoint != nil:
+		id := state.CurrentThread.Breakpoint.ID
+		result["reason"] = "breakpoint-hit"
+		result["bkptno"] = strconv.Itoa(id)
+		result["disp"] = "keep"
+
+		d.mutex.Lock()
+		temporary := d.temporary[id]
+		d.mutex.Unlock()
+
+		if temporary {
+			result["disp"] = "del"
+			d.clearBreakpoint(id)
+		}
+	case stepping && state.CurrentThread != nil && len(state.CurrentThread.ReturnValues) > 0:
+		values := []string{}
+		for _, v := range state.CurrentThread.ReturnValues {
+			values = append(values, v.Name+" = "+dlvValue(&v))
+		}
+		result["reason"] = "function-finished"
+		result["return-value"] = strings.Join(values, ", ")
+	case stepping:
+		result["reason"] = "end-stepping-range"
+	default:
+		result["reason"] = "signal-received"
+		result["signal-name"] = "SIGINT"
+	}
+
+	if state.SelectedGoroutine != nil {
+		d.mutex.Lock()
+		d.goroutine = state.SelectedGoroutine.ID
+		d.mutex.Unlock()
+
+		// Kept to tell which registers change from one stop to the next
+		registers, _ := d.listRegisters()
+		d.mutex.Lock()
+		d.lastStopRegisters = d.stopRegisters
+		d.stopRegisters = registers
+		d.mutex.Unlock()
+
+		result["thread-id"] = strconv.FormatInt(state.SelectedGoroutine.ID, 10)
+		result["frame"] = dlvFrame(0, state.SelectedGoroutine.UserCurrentLoc)
+		if instruction {
+			result["frame"] = dlvFrame(0, state.SelectedGoroutine.CurrentLoc)
+		}
+		result["pc"] = "0x" + strconv.FormatUint(state.SelectedGoroutine.CurrentLoc.PC, 16)
+	}
+	result["stopped-threads"] = "all"
+
+	return gdblib.AsyncResultRecord{Indication: "stopped", Result: result}
+}
+
+func dlvFrame(level int, loc dlvLocation) miFrame {
+	frame := miFrame{Level: strconv.Itoa(level), Addr: "0x" + strconv.FormatUint(loc.PC, 16),
+		File: filepath.Base(loc.File), Fullname: loc.File, Line: strconv.Itoa(loc.Line)}
+	if loc.Function != nil {
+		frame.Func = loc.Function.Name
+	}
+	return frame
+}
+
+func (d *delveDebugger) ExecArgs(args []string) error {
+	if args == nil {
+		args = []string{}
+	}
+
+	out := struct{}{}
+	return d.call("Restart", map[string]interface{}{"ResetArgs": true, "NewArgs": args}, &out)
+}
+
+func (d *delveDebugger) ExecRun(parms gdblib.ExecRunParms) error {
+	// Delve has already launched the target, stopped on its first instruction
+	return d.command("continue", false)
+}
+
+func (d *delveDebugger) ExecNext(parms gdblib.ExecNextParms) error {
+	return d.command("next", true)
+}
+
+func (d *delveDebugger) ExecStep(parms gdblib.ExecStepParms) error {
+	return d.command("step", true)
+}
+
+func (d *delveDebugger) ExecNextInstruction(parms gdblib.ExecNextInstructionParms) error {
+	return d.command("nextInstruction", true)
+}
+
+func (d *delveDebugger) ExecStepInstruction(parms gdblib.ExecStepInstructionParms) error {
+	return d.command("stepInstruction", true)
+}
+
+func (d *delveDebugger) ExecContinue(parms gdblib.ExecContinueParms) error {
+	return d.command("continue", false)
+}
+
+func (d *delveDebugger) ExecFinish(parms gdblib.ExecFinishParms) error {
+	return d.command("stepOut", true)
+}
+
+// ExecUntil runs to a location with a temporary breakpoint since Delve
+// has no until command of its own.
+func (d *delveDebugger) ExecUntil(parms gdblib.ExecUntilParms) error {
+	if parms.Location == "" {
+		return d.command("next", true)
+	}
+
+	_, err := d.BreakInsert(gdblib.BreakInsertParms{Location: parms.Location, Temporary: true})
+	if err != nil {
+		return err
+	}
+	return d.command("continue", false)
+}
+
+func (d *delveDebugger) ExecJump(parms gdblib.ExecJumpParms) error {
+	return errors.New("Delve can't jump to another location")
+}
+
+func (d *delveDebugger) ExecReturn(parms gdblib.ExecReturnParms) (interface{}, error) {
+	return nil, errors.New("Delve can't return early from a function")
+}
+
+func (d *delveDebugger) ExecInterrupt(parms gdblib.ExecInterruptParms) error {
+	out := struct{ State dlvState }{}
+	return d.call("Command", map[string]interface{}{"name": "halt"}, &out)
+}
+
+func (d *delveDebugger) bkpt(bp *dlvBreakpoint) miBreakpoint {
+	enabled := "y"
+	if bp.Disabled {
+		enabled = "n"
+	}
+
+	d.mutex.Lock()
+	disp := "keep"
+	if d.temporary[bp.ID] {
+		disp = "del"
+	}
+	d.mutex.Unlock()
+
+	record := miBreakpoint{Number: strconv.Itoa(bp.ID), Type: "breakpoint", Disp: disp, Enabled: enabled,
+		Func: bp.FunctionName, File: filepath.Base(bp.File), Fullname: bp.File,
+		Line: strconv.Itoa(bp.Line), Cond: bp.Cond, Times: strconv.FormatUint(bp.TotalHitCount, 10)}
+
+	if bp.WatchExpr != "" {
+		record = miBreakpoint{Number: record.Number, Type: dlvWatchKinds[bp.WatchType].breakType,
+			Disp: disp, Enabled: enabled, What: bp.WatchExpr, Cond: bp.Cond, Times: record.Times}
+	}
+
+	// Ignore counts are expressed as hit conditions
+	if strings.HasPrefix(bp.HitCond, "> ") {
+		record.Ignore = bp.HitCond[len("> "):]
+	}
+
+	return record
+}
+
+func (d *delveDebugger) listBreakpoints() ([]*dlvBreakpoint, error) {
+	out := struct{ Breakpoints []*dlvBreakpoint }{}
+	err := d.call("ListBreakpoints", map[string]interface{}{}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	// Negative IDs are Delve's own internal breakpoints
+	breakpoints := []*dlvBreakpoint{}
+	for _, bp := range out.Breakpoints {
+		if bp.ID > 0 {
+			breakpoints = append(breakpoints, bp)
+		}
+	}
+	return breakpoints, nil
+}
+
+func (d *delveDebugger) BreakList() (interface{}, error) {
+	breakpoints, err := d.listBreakpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	result := miBreakList{}
+	result.BreakPointTable.Body = []miBreakpoint{}
+	for _, bp := range breakpoints {
+		result.BreakPointTable.Body = append(result.BreakPointTable.Body, d.bkpt(bp))
+	}
+	return result, nil
+}
+
+func (d *delveDebugger) BreakInsert(parms gdblib.BreakInsertParms) (interface{}, error) {
+	locations := struct{ Locations []dlvLocation }{}
+	err := d.call("FindLocation", map[string]interface{}{"Scope": d.scope(), "Loc": parms.Location}, &locations)
+	if err != nil {
+		return nil, err
+	}
+	if len(locations.Locations) == 0 {
+		// Delve has no notion of a pending breakpoint
+		return nil, errors.New("No location found for " + parms.Location)
+	}
+
+	loc := locations.Locations[0]
+	bp := dlvBreakpoint{File: loc.File, Line: loc.Line, Cond: parms.Condition}
+	if loc.Function != nil {
+		bp.FunctionName = loc.Function.Name
+	}
+	if parms.IgnoreCount > 0 {
+		bp.HitCond = "> " + strconv.Itoa(parms.IgnoreCount)
+	}
+
+	out := struct{ Breakpoint dlvBreakpoint }{}
+	err = d.call("CreateBreakpoint", map[string]interface{}{"Breakpoint": bp}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	if parms.Temporary {
+		d.mutex.Lock()
+		d.temporary[out.Breakpoint.ID] = true
+		d.mutex.Unlock()
+	}
+
+	return miBreakInsert{Bkpt: d.bkpt(&out.Breakpoint)}, nil
+}
+
+func (d *delveDebugger) amendBreakpoints(numbers []string, amend func(bp *dlvBreakpoint)) error {
+	breakpoints, err := d.listBreakpoints()
+	if err != nil {
+		return err
+	}
+
+	for _, number := range numbers {
+		found := false
+
+		for _, bp := range breakpoints {
+			if strconv.Itoa(bp.ID) == number {
+				found = true
+				amend(bp)
+
+				out := struct{}{}
+				err = d.call("AmendBreakpoint", map[string]interface{}{"Breakpoint": bp}, &out)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if !found {
+			return errors.New("No breakpoint number " + number)
+		}
+	}
+	return nil
+}
+
+func (d *delveDebugger) BreakEnable(parms gdblib.BreakEnableParms) error {
+	return d.amendBreakpoints(parms.Breakpoints, func(bp *dlvBreakpoint) { bp.Disabled = false })
+}
+
+func (d *delveDebugger) BreakDisable(parms gdblib.BreakDisableParms) error {
+	return d.amendBreakpoints(parms.Breakpoints, func(bp *dlvBreakpoint) { bp.Disabled = true })
+}
+
+func (d *delveDebugger) BreakCondition(parms gdblib.BreakConditionParms) error {
+	return d.amendBreakpoints([]string{parms.Number}, func(bp *dlvBreakpoint) { bp.Cond = parms.Condition })
+}
+
+func (d *delveDebugger) BreakAfter(parms gdblib.BreakAfterParms) error {
+	return d.amendBreakpoints([]string{parms.Number}, func(bp *dlvBreakpoint) {
+		bp.HitCond = ""
+		if parms.Count > 0 {
+			bp.HitCond = "> " + strconv.Itoa(parms.Count)
+		}
+	})
+}
+
+// dlvWatchKinds describes each kind of watchpoint in gdb's terms.
+var dlvWatchKinds = map[int]struct {
+	breakType string
+	reason    string
+	key       string
+}{
+	dlvWatchWrite:                {"hw watchpoint", "watchpoint-trigger", "wpt"},
+	dlvWatchRead:                 {"read watchpoint", "read-watchpoint-trigger", "hw-rwpt"},
+	dlvWatchRead | dlvWatchWrite: {"acc watchpoint", "access-watchpoint-trigger", "hw-awpt"},
+}
+
+// BreakWatch creates a watchpoint. Delve always watches the memory that
+// an expression refers to so an address such as &s.field is watched
+// through what it points to.
+func (d *delveDebugger) BreakWatch(parms gdblib.BreakWatchParms) (interface{}, error) {
+	expression := strings.TrimSpace(parms.Expression)
+	if strings.HasPrefix(expression, "&") {
+		expression = "*(" + expression + ")"
+	}
+
+	watchType := dlvWatchWrite
+	switch {
+	case parms.Read:
+		watchType = dlvWatchRead
+	case parms.Access:
+		watchType = dlvWatchRead | dlvWatchWrite
+	}
+
+	scope := d.scope()
+	out := struct{ Breakpoint dlvBreakpoint }{}
+	err := d.call("CreateWatchpoint", map[string]interface{}{"Scope": scope, "Expr": expression, "Type": watchType}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	if value, err := d.eval(expression, scope); err == nil {
+		d.mutex.Lock()
+		d.watched[out.Breakpoint.ID] = dlvValue(value)
+		d.mutex.Unlock()
+	}
+
+	kind := dlvWatchKinds[watchType]
+	return map[string]interface{}{kind.key: miWatchpoint{Number: strconv.Itoa(out.Breakpoint.ID), Exp: expression}}, nil
+}
+
+// watchpointRecord fills in a stop record for a triggered watchpoint. Delve
+// doesn't report the old value so the value from the last trigger is used.
+func (d *delveDebugger) watchpointRecord(bp *dlvBreakpoint, scope dlvEvalScope, result map[string]interface{}) {
+	kind := dlvWatchKinds[bp.WatchType]
+	result["reason"] = kind.reason
+	result[kind.key] = miWatchpoint{Number: strconv.Itoa(bp.ID), Exp: bp.WatchExpr}
+
+	value, err := d.eval(bp.WatchExpr, scope)
+	if err != nil {
+		return
+	}
+
+	d.mutex.Lock()
+	old, seen := d.watched[bp.ID]
+	d.watched[bp.ID] = dlvValue(value)
+	d.mutex.Unlock()
+
+	switch {
+	case bp.WatchType == dlvWatchRead:
+		result["value"] = map[string]interface{}{"value": dlvValue(value)}
+	case seen:
+		result["value"] = map[string]interface{}{"old": old, "new": dlvValue(value)}
+	default:
+		result["value"] = map[string]interface{}{"new": dlvValue(value)}
+	}
+}
+
+func (d *delveDebugger) clearBreakpoint(id int) error {
+	d.mutex.Lock()
+	delete(d.temporary, id)
+	delete(d.watched, id)
+	d.mutex.Unlock()
+
+	out := struct{}{}
+	return d.call("ClearBreakpoint", map[string]interface{}{"Id": id}, &out)
+}
+
+func (d *delveDebugger) BreakDelete(parms gdblib.BreakDeleteParms) error {
+	for _, number := range parms.Breakpoints {
+		id, err := strconv.Atoi(number)
+		if err != nil {
+			return err
+		}
+
+		err = d.clearBreakpoint(id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *delveDebugger) listGoroutines() ([]*dlvGoroutine, error) {
+	out := struct{ Goroutines []*dlvGoroutine }{}
+	err := d.call("ListGoroutines", map[string]interface{}{"Start": 0, "Count": 0}, &out)
+	return out.Goroutines, err
+}
+
+func (d *delveDebugger) ThreadListIds() (interface{}, error) {
+	goroutines, err := d.listGoroutines()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, g := range goroutines {
+		ids = append(ids, strconv.FormatInt(g.ID, 10))
+	}
+
+	d.mutex.Lock()
+	current := strconv.FormatInt(d.goroutine, 10)
+	d.mutex.Unlock()
+
+	return map[string]interface{}{"thread-ids": ids, "current-thread-id": current,
+		"number-of-threads": strconv.Itoa(len(ids))}, nil
+}
+
+func (d *delveDebugger) ThreadSelect(parms gdblib.ThreadSelectParms) (interface{}, error) {
+	id, err := strconv.ParseInt(parms.ThreadId, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	out := struct{ State dlvState }{}
+	err = d.call("Command", map[string]interface{}{"name": "switchGoroutine", "goroutineID": id}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	d.goroutine = id
+	d.frame = 0
+	d.mutex.Unlock()
+
+	return map[string]interface{}{"new-thread-id": parms.ThreadId}, nil
+}
+
+func (d *delveDebugger) ThreadInfo(parms gdblib.ThreadInfoParms) (interface{}, error) {
+	goroutines, err := d.listGoroutines()
+	if err != nil {
+		return nil, err
+	}
+
+	result := miThreads{Threads: []miThread{}}
+
+	d.mutex.Lock()
+	result.CurrentThreadId = strconv.FormatInt(d.goroutine, 10)
+	d.mutex.Unlock()
+
+	for _, g := range goroutines {
+		id := strconv.FormatInt(g.ID, 10)
+		if parms.ThreadId != "" && parms.ThreadId != id {
+			continue
+		}
+
+		result.Threads = append(result.Threads, miThread{Id: id, TargetId: "goroutine " + id,
+			State: "stopped", Frame: dlvFrame(0, g.UserCurrentLoc)})
+	}
+
+	return result, nil
+}
+
+func (d *delveDebugger) stacktrace(goroutine int64) ([]dlvLocation, error) {
+	out := struct{ Locations []dlvLocation }{}
+	err := d.call("Stacktrace", map[string]interface{}{"Id": goroutine, "Depth": 50}, &out)
+	return out.Locations, err
+}
+
+func (d *delveDebugger) StackInfoFrame() (interface{}, error) {
+	scope := d.scope()
+
+	locations, err := d.stacktrace(scope.GoroutineID)
+	if err != nil {
+		return nil, err
+	}
+	if scope.Frame >= len(locations) {
+		return nil, errors.New("No stack")
+	}
+
+	return map[string]interface{}{"frame": dlvFrame(scope.Frame, locations[scope.Frame])}, nil
+}
+
+func (d *delveDebugger) StackSelectFrame(parms gdblib.StackSelectFrameParms) error {
+	frame, err := strconv.Atoi(parms.Frame)
+	if err != nil {
+		return err
+	}
+
+	locations, err := d.stacktrace(d.scope().GoroutineID)
+	if err != nil {
+		return err
+	}
+	if frame < 0 || frame >= len(locations) {
+		return errors.New("No frame " + parms.Frame)
+	}
+
+	d.mutex.Lock()
+	d.frame = frame
+	d.mutex.Unlock()
+
+	return nil
+}
+
+func (d *delveDebugger) StackListFrames(parms gdblib.StackListFramesParms) (interface{}, error) {
+	goroutine := d.scope().GoroutineID
+	if parms.ThreadId != "" {
+		id, err := strconv.ParseInt(parms.ThreadId, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		goroutine = id
+	}
+
+	locations, err := d.stacktrace(goroutine)
+	if err != nil {
+		return nil, err
+	}
+
+	result := miStack{Stack: []miFrame{}}
+	for level, loc := range locations {
+		result.Stack = append(result.Stack, dlvFrame(level, loc))
+	}
+	return result, nil
+}
+
+func (d *delveDebugger) StackListVariables(parms gdblib.StackListVariablesParms) (interface{}, error) {
+	scope := d.scope()
+	if parms.Thread != "" {
+		id, err := strconv.ParseInt(parms.Thread, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		scope.GoroutineID = id
+	}
+	if parms.Frame != "" {
+		frame, err := strconv.Atoi(parms.Frame)
+		if err != nil {
+			return nil, err
+		}
+		scope.Frame = frame
+	}
+
+	in := map[string]interface{}{"Scope": scope, "Cfg": dlvDefaultLoadConfig}
+
+	args := struct{ Args []dlvVariable }{}
+	err := d.call("ListFunctionArgs", in, &args)
+	if err != nil {
+		return nil, err
+	}
+
+	locals := struct{ Variables []dlvVariable }{}
+	err = d.call("ListLocalVars", in, &locals)
+	if err != nil {
+		return nil, err
+	}
+
+	result := miVariables{Variables: []miVariable{}}
+	for _, v := range append(args.Args, locals.Variables...) {
+		variable := miVariable{Name: v.Name, Type: v.Type}
+		if parms.AllValues {
+			variable.Value = dlvValue(&v)
+		}
+		result.Variables = append(result.Variables, variable)
+	}
+	return result, nil
+}
+
+// DataDisassemble gives the instructions in the same form as gdb. An end
+// address of zero has Delve disassemble the whole function.
+func (d *delveDebugger) DataDisassemble(parms gdblib.DataDisassembleParms) (interface{}, error) {
+	in := map[string]interface{}{"Scope": d.scope(), "Flavour": dlvGNUFlavour}
+
+	if parms.Filename != "" {
+		location := parms.Filename + ":" + strconv.Itoa(parms.Linenum)
+		locations := struct{ Locations []dlvLocation }{}
+		err := d.call("FindLocation", map[string]interface{}{"Scope": d.scope(), "Loc": location}, &locations)
+		if err != nil {
+			return nil, err
+		}
+		if len(locations.Locations) == 0 {
+			return nil, errors.New("No location found for " + location)
+		}
+		in["StartPC"] = locations.Locations[0].PC
+		in["EndPC"] = 0
+	} else {
+		for key, addr := range map[string]string{"StartPC": parms.StartAddr, "EndPC": parms.EndAddr} {
+			pc, err := strconv.ParseUint(addr, 0, 64)
+			if err != nil {
+				return nil, errors.New("Invalid address: " + addr)
+			}
+			in[key] = pc
+		}
+	}
+
+	out := struct{ Disassemble []dlvInstruction }{}
+	err := d.call("Disassemble", in, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	instructions := []miInstruction{}
+	lines := []miSourceLine{}
+	for _, asm := range out.Disassemble {
+		instruction := miInstruction{Address: "0x" + strconv.FormatUint(asm.Loc.PC, 16), Inst: asm.Text}
+		if asm.Loc.Function != nil {
+			instruction.FuncName = asm.Loc.Function.Name
+			instruction.Offset = strconv.FormatUint(asm.Loc.PC-asm.Loc.Function.Value, 10)
+		}
+		if parms.Mode&disassembleOpcodes != 0 {
+			opcodes := []string{}
+			for _, b := range asm.Bytes {
+				opcodes = append(opcodes, fmt.Sprintf("%02x", b))
+			}
+			instruction.Opcodes = strings.Join(opcodes, " ")
+		}
+
+		if parms.Mode&disassembleSource == 0 {
+			instructions = append(instructions, instruction)
+			continue
+		}
+
+		// Consecutive instructions from the same line are grouped together
+		line := strconv.Itoa(asm.Loc.Line)
+		if len(lines) == 0 || lines[len(lines)-1].Fullname != asm.Loc.File || lines[len(lines)-1].Line != line {
+			lines = append(lines, miSourceLine{Line: line, File: filepath.Base(asm.Loc.File),
+				Fullname: asm.Loc.File, Instructions: []miInstruction{}})
+		}
+		lines[len(lines)-1].Instructions = append(lines[len(lines)-1].Instructions, instruction)
+	}
+
+	if parms.Mode&disassembleSource != 0 {
+		return map[string]interface{}{"asm_insns": lines}, nil
+	}
+	return map[string]interface{}{"asm_insns": instructions}, nil
+}
+
+func (d *delveDebugger) listRegisters() ([]dlvRegister, error) {
+	scope := d.scope()
+	out := struct{ Regs []dlvRegister }{}
+	err := d.call("ListRegisters", map[string]interface{}{"Scope": &scope}, &out)
+
+	for idx := range out.Regs {
+		out.Regs[idx].Name = strings.ToLower(out.Regs[idx].Name)
+	}
+	return out.Regs, err
+}
+
+// Delve doesn't number its registers so their position stands in for a
+// number.
+func (d *delveDebugger) DataListRegisterNames() (interface{}, error) {
+	registers, err := d.listRegisters()
+	if err != nil {
+		return nil, err
+	}
+
+	result := miRegisterNames{Names: []string{}}
+	for _, reg := range registers {
+		result.Names = append(result.Names, reg.Name)
+	}
+	return result, nil
+}
+
+// DataListRegisterValues always gives the values in hex since that is
+// all that Delve has.
+func (d *delveDebugger) DataListRegisterValues(parms gdblib.DataListRegisterValuesParms) (interface{}, error) {
+	registers, err := d.listRegisters()
+	if err != nil {
+		return nil, err
+	}
+
+	result := miRegisterValues{Values: []miRegisterValue{}}
+	for idx, reg := range registers {
+		result.Values = append(result.Values, miRegisterValue{Number: strconv.Itoa(idx), Value: reg.Value})
+	}
+	return result, nil
+}
+
+func (d *delveDebugger) DataListChangedRegisters() (interface{}, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	previous := make(map[string]string)
+	for _, reg := range d.lastStopRegisters {
+		previous[reg.Name] = reg.Value
+	}
+
+	result := miChangedRegisters{Changed: []string{}}
+	for idx, reg := range d.stopRegisters {
+		if value, ok := previous[reg.Name]; ok && value != reg.Value {
+			result.Changed = append(result.Changed, strconv.Itoa(idx))
+		}
+	}
+	return result, nil
+}
+
+// memoryAddress works out an address the way gdb would, from a number or
+// the value of an expression.
+func (d *delveDebugger) memoryAddress(address string) (uint64, error) {
+	addr, err := strconv.ParseUint(address, 0, 64)
+	if err == nil {
+		return addr, nil
+	}
+
+	value, err := d.eval(address, d.scope())
+	if err != nil {
+		return 0, err
+	}
+
+	if (value.Kind == dlvKindPtr || value.Kind == dlvKindUnsafePtr) && len(value.Children) > 0 {
+		return value.Children[0].Addr, nil
+	}
+
+	addr, err = strconv.ParseUint(value.Value, 0, 64)
+	if err != nil {
+		return 0, errors.New("Not an address: " + address)
+	}
+	return addr, nil
+}
+
+func (d *delveDebugger) DataReadMemoryBytes(parms gdblib.DataReadMemoryBytesParms) (interface{}, error) {
+	addr, err := d.memoryAddress(parms.Address)
+	if err != nil {
+		return nil, err
+	}
+	addr = uint64(int64(addr) + int64(parms.Offset))
+
+	out := struct{ Mem []byte }{}
+	err = d.call("ExamineMemory", map[string]interface{}{"Address": addr, "Length": parms.Count}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	return miMemory{Memory: []miMemoryBlock{{Begin: "0x" + strconv.FormatUint(addr, 16), Offset: "0x0",
+		End: "0x" + strconv.FormatUint(addr+uint64(len(out.Mem)), 16), Contents: hex.EncodeToString(out.Mem)}}}, nil
+}
+
+func (d *delveDebugger) DataWriteMemoryBytes(parms gdblib.DataWriteMemoryBytesParms) error {
+	return errors.New("Delve can't write to memory")
+}
+
+// dlvValue renders a Delve variable the way gdb's Go pretty printers would.
+func dlvValue(v *dlvVariable) string {
+	if v.Unreadable != "" {
+		return "<" + v.Unreadable + ">"
+	}
+
+	switch v.Kind {
+	case dlvKindString:
+		return strconv.Quote(v.Value)
+	case dlvKindArray, dlvKindSlice:
+		return fmt.Sprintf("%v len %v", v.Type, v.Len)
+	case dlvKindMap:
+		return fmt.Sprintf("%v with %v elements", v.Type, v.Len)
+	case dlvKindStruct, dlvKindInterface:
+		return "{...}"
+	case dlvKindPtr:
+		if len(v.Children) > 0 {
+			return "&" + dlvValue(&v.Children[0])
+		}
+	}
+	return v.Value
+}
+
+func (d *delveDebugger) eval(expression string, scope dlvEvalScope) (*dlvVariable, error) {
+	return d.evalConfig(expression, scope, dlvDefaultLoadConfig)
+}
+
+func (d *delveDebugger) evalConfig(expression string, scope dlvEvalScope, cfg dlvLoadConfig) (*dlvVariable, error) {
+	out := struct{ Variable *dlvVariable }{}
+	err := d.call("Eval", map[string]interface{}{"Scope": scope, "Expr": expression, "Cfg": cfg}, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Variable == nil {
+		return nil, errors.New("No value for " + expression)
+	}
+	return out.Variable, nil
+}
+
+// newVarobj registers a variable object and describes it like gdb would.
+func (d *delveDebugger) newVarobj(varobj *dlvVarobj, name string) miVariable {
+	d.mutex.Lock()
+	if name == "" {
+		d.nextVar++
+		name = "var" + strconv.Itoa(d.nextVar)
+	}
+	d.varobjs[name] = varobj
+	d.mutex.Unlock()
+
+	return miVariable{Name: name, Exp: varobj.value.Name, Value: varobj.describe(),
+		Type: varobj.value.Type, Numchild: strconv.Itoa(dlvNumChildren(varobj.value))}
+}
+
+func dlvNumChildren(v *dlvVariable) int {
+	switch v.Kind {
+	case dlvKindMap:
+		// Keys and values alternate
+		return int(v.Len)
+	case dlvKindArray, dlvKindSlice:
+		return int(v.Len)
+	case dlvKindStruct, dlvKindInterface, dlvKindPtr:
+		return len(v.Children)
+	}
+	return 0
+}
+
+func (d *delveDebugger) VarCreate(parms gdblib.VarCreateParms) (interface{}, error) {
+	scope := d.scope()
+
+	value, err := d.eval(parms.Expression, scope)
+	if err != nil {
+		return nil, err
+	}
+	value.Name = parms.Expression
+
+	return d.newVarobj(&dlvVarobj{expression: parms.Expression, scope: scope, value: value}, ""), nil
+}
+
+func (d *delveDebugger) VarDelete(parms gdblib.VarDeleteParms) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	// Children go along with their parent
+	for name := range d.varobjs {
+		if name == parms.Name || strings.HasPrefix(name, parms.Name+".") {
+			delete(d.varobjs, name)
+		}
+	}
+	return nil
+}
+
+func (d *delveDebugger) VarListChildren(parms gdblib.VarListChildrenParms) (interface{}, error) {
+	d.mutex.Lock()
+	parent := d.varobjs[parms.Name]
+	d.mutex.Unlock()
+
+	if parent == nil {
+		return nil, errors.New("No such variable object: " + parms.Name)
+	}
+
+	from, to := parms.From, parms.To
+	if to <= from {
+		to = from + childrenPageSize
+	}
+
+	// Reload to pick up the next level of children. Only the page that was
+	//  asked for is loaded from arrays, slices and maps by slicing them.
+	value := parent.value
+	offset := 0
+	if parent.expression != "" {
+		expression := parent.expression
+		cfg := dlvDefaultLoadConfig
+
+		switch value.Kind {
+		case dlvKindArray, dlvKindSlice, dlvKindMap:
+			if from > 0 {
+				expression = "(" + expression + ")[" + strconv.Itoa(from) + ":]"
+				offset = from
+			}
+			cfg.MaxArrayValues = to - from
+		}
+
+		reloaded, err := d.evalConfig(expression, parent.scope, cfg)
+		if err != nil {
+			return nil, err
+		}
+		value = reloaded
+	}
+
+	result := miChildren{Children: []miVariable{}}
+
+	for idx := range value.Children {
+		child := value.Children[idx]
+		expression := ""
+
+		// Index of the child among all of them, keys and values of maps
+		//  count as one
+		position := offset + idx
+		if value.Kind == dlvKindMap {
+			position = offset + idx/2
+		}
+		if position < from || position >= to {
+			continue
+		}
+
+		switch value.Kind {
+		case dlvKindStruct:
+			expression = "(" + parent.expression + ")." + child.Name
+		case dlvKindArray, dlvKindSlice:
+			child.Name = "[" + strconv.Itoa(position) + "]"
+			expression = "(" + parent.expression + ")" + child.Name
+		case dlvKindPtr:
+			child.Name = "*"
+			expression = "*(" + parent.expression + ")"
+		case dlvKindMap:
+			// Children alternate between keys and values
+			if idx%2 == 0 {
+				continue
+			}
+			child.Name = "[" + dlvValue(&value.Children[idx-1]) + "]"
+		}
+
+		if parent.expression == "" {
+			expression = ""
+		}
+
+		name := parms.Name + "." + strconv.Itoa(position)
+		result.Children = append(result.Children,
+			d.newVarobj(&dlvVarobj{expression: expression, scope: parent.scope, value: &child}, name))
+	}
+
+	// All of the children are counted, not just the page
+	result.Numchild = strconv.Itoa(dlvNumChildren(parent.value))
+	return result, nil
+}
+
+func (d *delveDebugger) varobj(name string) (*dlvVarobj, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	varobj := d.varobjs[name]
+	if varobj == nil {
+		return nil, errors.New("No such variable object: " + name)
+	}
+	return varobj, nil
+}
+
+func (d *delveDebugger) VarInfoNumChildren(parms gdblib.VarInfoNumChildrenParms) (interface{}, error) {
+	varobj, err := d.varobj(parms.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return miChildren{Numchild: strconv.Itoa(dlvNumChildren(varobj.value))}, nil
+}
+
+func (d *delveDebugger) VarInfoType(parms gdblib.VarInfoTypeParms) (interface{}, error) {
+	varobj, err := d.varobj(parms.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return miVarType{Type: varobj.value.Type}, nil
+}
+
+func (d *delveDebugger) VarAssign(parms gdblib.VarAssignParms) (interface{}, error) {
+	varobj, err := d.varobj(parms.Name)
+	if err != nil {
+		return nil, err
+	}
+	if varobj.expression == "" {
+		return nil, errors.New("Delve can't assign to " + varobj.value.Name)
+	}
+
+	err = d.call("Set", map[string]interface{}{"Scope": varobj.scope, "Symbol": varobj.expression,
+		"Value": parms.Expression}, &struct{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := d.eval(varobj.expression, varobj.scope)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	value.Name = varobj.value.Name
+	varobj.value = value
+
+	return map[string]interface{}{"value": varobj.describe()}, nil
+}
+
+func (d *delveDebugger) VarSetFormat(parms gdblib.VarSetFormatParms) (interface{}, error) {
+	varobj, err := d.varobj(parms.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	varobj.format = parms.FormatSpec
+	return miVarFormat{Format: parms.FormatSpec, Value: varobj.describe()}, nil
+}
+
+// VarSetVisualizer only knows the visualizer None since Delve has no
+// pretty printers of its own.
+func (d *delveDebugger) VarSetVisualizer(parms gdblib.VarSetVisualizerParms) error {
+	varobj, err := d.varobj(parms.Name)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	varobj.raw = parms.Visualizer == "None"
+	return nil
+}
+
+// VarUpdate evaluates the variable objects again to find the ones that
+// changed. Those that can't be evaluated any more have gone out of scope.
+func (d *delveDebugger) VarUpdate(parms gdblib.VarUpdateParms) (interface{}, error) {
+	d.mutex.Lock()
+	varobjs := make(map[string]*dlvVarobj)
+	for name, varobj := range d.varobjs {
+		if varobj.expression != "" && (parms.Name == "*" || parms.Name == name) {
+			varobjs[name] = varobj
+		}
+	}
+	d.mutex.Unlock()
+
+	result := miVarUpdate{Changelist: []miVarChange{}}
+
+	for name, varobj := range varobjs {
+		value, err := d.eval(varobj.expression, varobj.scope)
+		if err != nil {
+			result.Changelist = append(result.Changelist, miVarChange{Name: name, InScope: "false"})
+			continue
+		}
+
+		d.mutex.Lock()
+		old := varobj.describe()
+		value.Name = varobj.value.Name
+		varobj.value = value
+		updated := varobj.describe()
+		d.mutex.Unlock()
+
+		if updated != old {
+			result.Changelist = append(result.Changelist, miVarChange{Name: name, Value: updated, InScope: "true"})
+		}
+	}
+
+	return result, nil
+}
+
+func (d *delveDebugger) ConsoleLines() <-chan string {
+	return d.console
+}
+
+func (d *delveDebugger) TargetLines() <-chan string {
+	return d.target
+}
+
+func (d *delveDebugger) LogLines() <-chan string {
+	return d.log
+}
+
+func (d *delveDebugger) AsyncRecords() <-chan gdblib.AsyncResultRecord {
+	return d.async
+}
+
+func (d *delveDebugger) Exit() {
+	out := struct{}{}
+	err := d.call("Detach", map[string]interface{}{"Kill": !d.attached}, &out)
+	if err != nil {
+		d.cmd.Process.Kill()
+	}
+}
+
+// Attach isn't possible once Delve is running, it attaches to the process
+// that it is started with.
+func (d *delveDebugger) Attach(pid int) error {
+	return errors.New("Delve can only attach to a process when it starts, run godbg -backend=dlv attach " +
+		strconv.Itoa(pid) + " instead")
+}
+
+// Detach lets the process carry on running without the debugger. Delve
+// exits along with the session.
+func (d *delveDebugger) Detach() error {
+	out := struct{}{}
+	return d.call("Detach", map[string]interface{}{"Kill": false}, &out)
+}
+
+func (d *delveDebugger) Wait() error {
+	return d.cmd.Wait()
+}
@@ -0,0 +1,129 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Modes of -data-disassemble
+const (
+	disassembleSource  = 1 << 0
+	disassembleOpcodes = 1 << 1
+)
+
+// addProgramCounter gives a stop record the address of the instruction
+// that the program stopped at so that the client can follow along in the
+// disassembly. Backends that know better can set it themselves.
+func addProgramCounter(record gdblib.AsyncResultRecord) {
+	if record.Indication != "stopped" || record.Result == nil {
+		return
+	}
+	if _, ok := record.Result["pc"]; ok {
+		return
+	}
+
+	stop := miStop{}
+	if remarshal(record.Result, &stop) == nil && stop.Frame.Addr != "" {
+		record.Result["pc"] = stop.Frame.Addr
+	}
+}
+
+// disassembleParms works out what to disassemble, the given address
+// range, the function of the given line or else the whole function of
+// the selected frame.
+func disassembleParms(mygdb Debugger, startAddr string, endAddr string, file string, line int, mode int) (gdblib.DataDisassembleParms, error) {
+	// A line with no limit disassembles its whole function
+	parms := gdblib.DataDisassembleParms{Mode: mode, Filename: file, Linenum: line, Lines: -1}
+
+	switch {
+	case startAddr != "" && endAddr != "":
+		return gdblib.DataDisassembleParms{Mode: mode, StartAddr: startAddr, EndAddr: endAddr}, nil
+	case startAddr != "" || endAddr != "":
+		return parms, errors.New("Expected both a start and an end address")
+	case file != "":
+		return parms, nil
+	}
+
+	result, err := mygdb.StackInfoFrame()
+	if err != nil {
+		return parms, err
+	}
+
+	info := miFrameInfo{}
+	remarshal(result, &info)
+
+	parms.Linenum, err = strconv.Atoi(info.Frame.Line)
+	if err != nil || info.Frame.Fullname == "" {
+		return parms, errors.New("No source for the current function")
+	}
+	parms.Filename = info.Frame.Fullname
+	return parms, nil
+}
+
+func addDisassembleHandlers(mygdb Debugger) {
+	http.HandleFunc("/handle/disassemble", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			// Range of addresses to disassemble, the current function if empty
+			StartAddr string
+			EndAddr   string
+			// A line in the function to disassemble instead
+			File string
+			Line int
+			// Interleave the source lines with their instructions
+			Source bool
+			// Include the bytes of each instruction
+			Opcodes bool
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil && err != io.EOF {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		mode := 0
+		if parms.Source {
+			mode |= disassembleSource
+		}
+		if parms.Opcodes {
+			mode |= disassembleOpcodes
+		}
+
+		disassemble, err := disassembleParms(mygdb, parms.StartAddr, parms.EndAddr, parms.File, parms.Line, mode)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		result, err := mygdb.DataDisassemble(disassemble)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(result)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+}
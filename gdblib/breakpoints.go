@@ -0,0 +1,138 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+import (
+	"errors"
+	"strconv"
+)
+
+type BreakInsertParms struct {
+	Location  string
+	Temporary bool
+	// Set the breakpoint even if the location isn't known yet, in a shared
+	//  library that isn't loaded for example
+	Pending     bool
+	Condition   string
+	IgnoreCount int
+}
+
+type BreakWatchParms struct {
+	Expression string
+	// Stop when the expression is read rather than written
+	Read bool
+	// Stop when the expression is either read or written
+	Access bool
+}
+
+type BreakEnableParms struct {
+	Breakpoints []string
+}
+
+type BreakDisableParms struct {
+	Breakpoints []string
+}
+
+type BreakDeleteParms struct {
+	Breakpoints []string
+}
+
+type BreakConditionParms struct {
+	Number string
+	// The condition is removed if this is empty
+	Condition string
+}
+
+type BreakAfterParms struct {
+	Number string
+	Count  int
+}
+
+// BreakListResult is the table of breakpoints. Only the body is kept.
+type BreakListResult struct {
+	BreakPointTable struct {
+		Body []interface{} `json:"body"`
+	}
+}
+
+func (g *GDB) BreakList() (*BreakListResult, error) {
+	result, err := g.send("-break-list")
+	if err != nil {
+		return nil, err
+	}
+
+	table, _ := result["BreakpointTable"].(map[string]interface{})
+	if table == nil {
+		return nil, errors.New("gdb gave no breakpoint table")
+	}
+
+	list := &BreakListResult{}
+	list.BreakPointTable.Body, _ = table["body"].([]interface{})
+	if list.BreakPointTable.Body == nil {
+		list.BreakPointTable.Body = []interface{}{}
+	}
+	return list, nil
+}
+
+func (g *GDB) BreakInsert(parms BreakInsertParms) (Result, error) {
+	parameters := []string{}
+	if parms.Temporary {
+		parameters = append(parameters, "-t")
+	}
+	if parms.Pending {
+		parameters = append(parameters, "-f")
+	}
+	if parms.Condition != "" {
+		parameters = append(parameters, "-c", parms.Condition)
+	}
+	if parms.IgnoreCount > 0 {
+		parameters = append(parameters, "-i", strconv.Itoa(parms.IgnoreCount))
+	}
+	parameters = append(parameters, parms.Location)
+
+	return g.send("-break-insert", parameters...)
+}
+
+func (g *GDB) BreakWatch(parms BreakWatchParms) (Result, error) {
+	parameters := []string{}
+	switch {
+	case parms.Access:
+		parameters = append(parameters, "-a")
+	case parms.Read:
+		parameters = append(parameters, "-r")
+	}
+	parameters = append(parameters, parms.Expression)
+
+	return g.send("-break-watch", parameters...)
+}
+
+func (g *GDB) BreakEnable(parms BreakEnableParms) error {
+	_, err := g.send("-break-enable", parms.Breakpoints...)
+	return err
+}
+
+func (g *GDB) BreakDisable(parms BreakDisableParms) error {
+	_, err := g.send("-break-disable", parms.Breakpoints...)
+	return err
+}
+
+func (g *GDB) BreakDelete(parms BreakDeleteParms) error {
+	_, err := g.send("-break-delete", parms.Breakpoints...)
+	return err
+}
+
+func (g *GDB) BreakCondition(parms BreakConditionParms) error {
+	if parms.Condition == "" {
+		_, err := g.send("-break-condition", parms.Number)
+		return err
+	}
+	_, err := g.send("-break-condition", parms.Number, parms.Condition)
+	return err
+}
+
+func (g *GDB) BreakAfter(parms BreakAfterParms) error {
+	_, err := g.send("-break-after", parms.Number, strconv.Itoa(parms.Count))
+	return err
+}
@@ -0,0 +1,86 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+import (
+	"strconv"
+)
+
+type DataDisassembleParms struct {
+	// Either an address range or a line of a file is disassembled
+	StartAddr string
+	EndAddr   string
+	Filename  string
+	Linenum   int
+	// How many lines to disassemble from the line, the whole function if
+	//  this is -1
+	Lines int
+	// 0 disassembly only, 1 mixed with the source, 2 with the raw opcodes,
+	//  3 with both
+	Mode int
+}
+
+type DataListRegisterValuesParms struct {
+	// One of x, o, t, d, r or N for natural, the default
+	Format string
+}
+
+type DataReadMemoryBytesParms struct {
+	Address string
+	Offset  int
+	Count   int
+}
+
+type DataWriteMemoryBytesParms struct {
+	Address string
+	// The bytes written, in hexadecimal
+	Contents string
+}
+
+func (g *GDB) DataDisassemble(parms DataDisassembleParms) (Result, error) {
+	parameters := []string{}
+	if parms.Filename != "" {
+		parameters = append(parameters, "-f", parms.Filename, "-l", strconv.Itoa(parms.Linenum))
+		if parms.Lines != 0 {
+			parameters = append(parameters, "-n", strconv.Itoa(parms.Lines))
+		}
+	} else {
+		parameters = append(parameters, "-s", parms.StartAddr, "-e", parms.EndAddr)
+	}
+	parameters = append(parameters, "--", strconv.Itoa(parms.Mode))
+
+	return g.send("-data-disassemble", parameters...)
+}
+
+func (g *GDB) DataListRegisterNames() (Result, error) {
+	return g.send("-data-list-register-names")
+}
+
+func (g *GDB) DataListRegisterValues(parms DataListRegisterValuesParms) (Result, error) {
+	format := parms.Format
+	if format == "" {
+		format = "N"
+	}
+	return g.send("-data-list-register-values", format)
+}
+
+func (g *GDB) DataListChangedRegisters() (Result, error) {
+	return g.send("-data-list-changed-registers")
+}
+
+func (g *GDB) DataReadMemoryBytes(parms DataReadMemoryBytesParms) (Result, error) {
+	parameters := []string{}
+	if parms.Offset != 0 {
+		parameters = append(parameters, "-o", strconv.Itoa(parms.Offset))
+	}
+	parameters = append(parameters, parms.Address, strconv.Itoa(parms.Count))
+
+	return g.send("-data-read-memory-bytes", parameters...)
+}
+
+func (g *GDB) DataWriteMemoryBytes(parms DataWriteMemoryBytesParms) error {
+	_, err := g.send("-data-write-memory-bytes", parms.Address, parms.Contents)
+	return err
+}
@@ -0,0 +1,123 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+// Execution commands return once the program is running again. Where it
+// stops is given by a stopped record.
+
+type ExecRunParms struct{}
+
+type ExecArgsParms struct {
+	// Arguments as the shell that starts the program takes them
+	Args string
+}
+
+type ExecNextParms struct {
+	Thread string
+}
+
+type ExecStepParms struct {
+	Thread string
+}
+
+type ExecNextInstructionParms struct{}
+
+type ExecStepInstructionParms struct{}
+
+type ExecContinueParms struct {
+	Thread string
+	All    bool
+}
+
+type ExecInterruptParms struct {
+	Thread string
+	All    bool
+}
+
+type ExecFinishParms struct{}
+
+type ExecUntilParms struct {
+	Location string
+}
+
+type ExecJumpParms struct {
+	Location string
+}
+
+type ExecReturnParms struct{}
+
+// threadParameters picks the threads that an execution command applies
+// to, the selected one by default.
+func threadParameters(thread string, all bool) []string {
+	switch {
+	case all:
+		return []string{"--all"}
+	case thread != "":
+		return []string{"--thread", thread}
+	}
+	return nil
+}
+
+func (g *GDB) ExecRun(parms ExecRunParms) error {
+	_, err := g.send("-exec-run")
+	return err
+}
+
+func (g *GDB) ExecArgs(parms ExecArgsParms) error {
+	// The arguments are taken as they are written
+	_, err := g.sendLine("-exec-arguments " + parms.Args)
+	return err
+}
+
+func (g *GDB) ExecNext(parms ExecNextParms) error {
+	_, err := g.send("-exec-next", threadParameters(parms.Thread, false)...)
+	return err
+}
+
+func (g *GDB) ExecStep(parms ExecStepParms) error {
+	_, err := g.send("-exec-step", threadParameters(parms.Thread, false)...)
+	return err
+}
+
+func (g *GDB) ExecNextInstruction(parms ExecNextInstructionParms) error {
+	_, err := g.send("-exec-next-instruction")
+	return err
+}
+
+func (g *GDB) ExecStepInstruction(parms ExecStepInstructionParms) error {
+	_, err := g.send("-exec-step-instruction")
+	return err
+}
+
+func (g *GDB) ExecContinue(parms ExecContinueParms) error {
+	_, err := g.send("-exec-continue", threadParameters(parms.Thread, parms.All)...)
+	return err
+}
+
+func (g *GDB) ExecInterrupt(parms ExecInterruptParms) error {
+	_, err := g.send("-exec-interrupt", threadParameters(parms.Thread, parms.All)...)
+	return err
+}
+
+func (g *GDB) ExecFinish(parms ExecFinishParms) error {
+	_, err := g.send("-exec-finish")
+	return err
+}
+
+func (g *GDB) ExecUntil(parms ExecUntilParms) error {
+	_, err := g.send("-exec-until", parms.Location)
+	return err
+}
+
+func (g *GDB) ExecJump(parms ExecJumpParms) error {
+	_, err := g.send("-exec-jump", parms.Location)
+	return err
+}
+
+// ExecReturn pops the selected frame without running the program, the
+// result is the frame returned to.
+func (g *GDB) ExecReturn(parms ExecReturnParms) (Result, error) {
+	return g.send("-exec-return")
+}
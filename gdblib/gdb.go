@@ -0,0 +1,389 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gdblib drives gdb through its machine interface. Each command
+// is a method that waits for gdb to answer. Results are given as they
+// are laid out by gdb with tuples as maps and lists as slices, so they
+// have the same JSON form as gdb's output. Everything else that gdb
+// prints comes through the channels of the GDB.
+package gdblib
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Result is the result of a command.
+type Result map[string]interface{}
+
+// AsyncResultRecord is an asynchronous record such as the program
+// stopping or a thread being created.
+type AsyncResultRecord struct {
+	// One of exec, status or notify
+	Type string
+	// Class of the record such as stopped or running
+	Indication string
+	Result     map[string]interface{}
+}
+
+// GDB is a running gdb. The channels must be drained for gdb to carry
+// on. Output is delivered in the order gdb gave it across all of them.
+type GDB struct {
+	// Output of the commands run in the console interpreter
+	Console chan string
+	// Output of the program being debugged
+	Target chan string
+	// gdb's own messages, errors and warnings
+	InternalLog  chan string
+	AsyncResults chan AsyncResultRecord
+
+	cmd *exec.Cmd
+	// Held while writing a command so that they don't get mixed up
+	stdinMutex sync.Mutex
+	stdin      io.WriteCloser
+	// Closed once gdb's output has all been read
+	done chan bool
+
+	// Terminal of the program, if there is one
+	ptyMaster *os.File
+	ptySlave  *os.File
+
+	mutex     sync.Mutex
+	nextToken int
+	pending   map[string]chan *outputRecord
+	exited    bool
+
+	events *eventQueue
+}
+
+// NewGDB starts gdb on a program. Sources are looked for in srcRoot, if
+// it isn't empty, as well as where the program was compiled.
+func NewGDB(program string, srcRoot string) (*GDB, error) {
+	gdbPath, err := exec.LookPath("gdb")
+	if err != nil {
+		return nil, errors.New("Could not find gdb on the PATH")
+	}
+
+	g := &GDB{Console: make(chan string), Target: make(chan string), InternalLog: make(chan string),
+		AsyncResults: make(chan AsyncResultRecord), done: make(chan bool),
+		pending: make(map[string]chan *outputRecord), events: newEventQueue()}
+
+	args := []string{"--interpreter=mi2", "--quiet"}
+	if program != "" {
+		args = append(args, program)
+	}
+	g.cmd = exec.Command(gdbPath, args...)
+
+	g.stdin, err = g.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := g.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := g.cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = g.cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	go g.deliver()
+	go g.readOutput(stdout)
+	go g.readStream(stderr, false)
+
+	err = g.setup(srcRoot)
+	if err != nil {
+		g.cmd.Process.Kill()
+		g.Wait()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// setup readies gdb to debug a Go program.
+func (g *GDB) setup(srcRoot string) error {
+	// Commands are taken while the program runs so that it can be
+	//  interrupted. Older versions of gdb call this target-async.
+	_, err := g.send("-gdb-set", "mi-async", "on")
+	if err != nil {
+		_, err = g.send("-gdb-set", "target-async", "on")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = g.send("-gdb-set", "confirm", "off")
+	if err != nil {
+		return err
+	}
+
+	_, err = g.send("-enable-pretty-printing")
+	if err != nil {
+		return err
+	}
+
+	if srcRoot != "" {
+		_, err = g.send("-environment-directory", srcRoot)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Without a terminal of its own the program writes to gdb's output
+	//  where it is picked out from the records as best as possible
+	master, slave, err := openPty()
+	if err != nil {
+		return nil
+	}
+
+	_, err = g.send("-inferior-tty-set", slave.Name())
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil
+	}
+
+	// The slave is held open so that reading the master doesn't fail
+	//  between runs of the program
+	g.ptyMaster = master
+	g.ptySlave = slave
+	go g.readStream(master, true)
+
+	return nil
+}
+
+// send runs a command with its parameters and waits for the result.
+func (g *GDB) send(command string, parameters ...string) (Result, error) {
+	line := command
+	for _, parameter := range parameters {
+		line += " " + quote(parameter)
+	}
+	return g.sendLine(line)
+}
+
+// sendLine runs a command that is already written out and waits for the
+// result.
+func (g *GDB) sendLine(line string) (Result, error) {
+	answer := make(chan *outputRecord, 1)
+
+	g.mutex.Lock()
+	if g.exited {
+		g.mutex.Unlock()
+		return nil, errors.New("gdb has exited")
+	}
+
+	g.nextToken++
+	token := strconv.Itoa(g.nextToken)
+	g.pending[token] = answer
+	g.mutex.Unlock()
+
+	g.stdinMutex.Lock()
+	_, err := io.WriteString(g.stdin, token+line+"\n")
+	g.stdinMutex.Unlock()
+
+	if err != nil {
+		g.mutex.Lock()
+		delete(g.pending, token)
+		g.mutex.Unlock()
+		return nil, err
+	}
+
+	record, ok := <-answer
+	if !ok {
+		return nil, errors.New("gdb has exited")
+	}
+
+	if record.class == "error" {
+		msg, _ := record.results["msg"].(string)
+		return nil, errors.New(msg)
+	}
+	return Result(record.results), nil
+}
+
+// readOutput reads gdb's output until it exits, handing out the results
+// of commands and queueing everything else.
+func (g *GDB) readOutput(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" && !isPrompt(line) {
+			g.dispatch(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	g.mutex.Lock()
+	g.exited = true
+	for token, answer := range g.pending {
+		close(answer)
+		delete(g.pending, token)
+	}
+	g.mutex.Unlock()
+
+	g.events.close()
+	close(g.done)
+}
+
+func (g *GDB) dispatch(line string) {
+	record, err := parseRecord(line)
+	if err != nil {
+		// The program shares gdb's output when it has no terminal
+		g.events.push(event{target: &line})
+		return
+	}
+
+	switch record.kind {
+	case '^':
+		g.mutex.Lock()
+		answer, ok := g.pending[record.token]
+		delete(g.pending, record.token)
+		g.mutex.Unlock()
+
+		if ok {
+			answer <- record
+		}
+	case '*', '+', '=':
+		types := map[byte]string{'*': "exec", '+': "status", '=': "notify"}
+		g.events.push(event{async: &AsyncResultRecord{Type: types[record.kind],
+			Indication: record.class, Result: record.results}})
+	case '~':
+		g.events.push(event{console: &record.text})
+	case '@':
+		g.events.push(event{target: &record.text})
+	case '&':
+		g.events.push(event{log: &record.text})
+	}
+}
+
+// readStream queues the output of the program's terminal as target
+// output or of gdb's stderr as log output.
+func (g *GDB) readStream(stream io.Reader, target bool) {
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			text := strings.Replace(string(buf[:n]), "\r\n", "\n", -1)
+			if target {
+				g.events.push(event{target: &text})
+			} else {
+				g.events.push(event{log: &text})
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// deliver sends the queued output on the channels in order.
+func (g *GDB) deliver() {
+	for {
+		e, ok := g.events.pop()
+		if !ok {
+			return
+		}
+
+		switch {
+		case e.async != nil:
+			g.AsyncResults <- *e.async
+		case e.console != nil:
+			g.Console <- *e.console
+		case e.target != nil:
+			g.Target <- *e.target
+		case e.log != nil:
+			g.InternalLog <- *e.log
+		}
+	}
+}
+
+// GdbExit ends gdb along with the program, unless it was attached to.
+func (g *GDB) GdbExit() {
+	g.send("-gdb-exit")
+}
+
+// Wait blocks until gdb has exited.
+func (g *GDB) Wait() error {
+	<-g.done
+	err := g.cmd.Wait()
+
+	if g.ptyMaster != nil {
+		g.ptySlave.Close()
+		g.ptyMaster.Close()
+	}
+	return err
+}
+
+// event is one piece of output waiting to be delivered, only one of the
+// fields is set.
+type event struct {
+	async   *AsyncResultRecord
+	console *string
+	target  *string
+	log     *string
+}
+
+// eventQueue holds the output that hasn't been delivered yet so that
+// reading gdb's output never waits on whoever drains the channels.
+type eventQueue struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	events []event
+	closed bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+func (q *eventQueue) push(e event) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.events = append(q.events, e)
+	q.cond.Signal()
+}
+
+// pop waits for the next event. It is false once the queue is closed and
+// empty.
+func (q *eventQueue) pop() (event, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.events) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.events) == 0 {
+		return event{}, false
+	}
+
+	e := q.events[0]
+	q.events = q.events[1:]
+	return e, true
+}
+
+func (q *eventQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.closed = true
+	q.cond.Signal()
+}
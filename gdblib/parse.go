@@ -0,0 +1,305 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// outputRecord is one line of gdb's machine interface output.
+type outputRecord struct {
+	token string
+	// One of ^ for results, * + = for async records and ~ @ & for streams
+	kind byte
+	// Result or async class such as done or stopped
+	class   string
+	results map[string]interface{}
+	// Text of a stream record
+	text string
+}
+
+// isPrompt reports whether a line is the (gdb) prompt that ends each
+// batch of output.
+func isPrompt(line string) bool {
+	return strings.TrimSpace(line) == "(gdb)"
+}
+
+// parseRecord parses a line of output. Tuples become maps and lists
+// become slices. Lists of results such as stack=[frame={...},frame={...}]
+// keep only the values since the names are all the same. Tuples that
+// repeat a name, such as thread-ids={thread-id="1",thread-id="2"}, have
+// the values of that name in a slice.
+func parseRecord(line string) (*outputRecord, error) {
+	p := &parser{s: strings.TrimRight(line, "\r\n")}
+	record := &outputRecord{}
+
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	record.token = p.s[start:p.pos]
+
+	if p.pos >= len(p.s) {
+		return nil, errors.New("Not a record: " + line)
+	}
+	record.kind = p.s[p.pos]
+	p.pos++
+
+	switch record.kind {
+	case '~', '@', '&':
+		if record.token != "" {
+			return nil, errors.New("Not a record: " + line)
+		}
+		text, err := p.cstring()
+		if err != nil {
+			return nil, err
+		}
+		record.text = text
+	case '^', '*', '+', '=':
+		start = p.pos
+		for p.pos < len(p.s) && p.s[p.pos] != ',' {
+			p.pos++
+		}
+		record.class = p.s[start:p.pos]
+		if record.class == "" {
+			return nil, errors.New("Not a record: " + line)
+		}
+
+		record.results = make(map[string]interface{})
+		repeated := make(map[string]bool)
+		name := ""
+		for p.pos < len(p.s) {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+
+			var value interface{}
+			var err error
+			if p.peek() == '{' && name != "" {
+				// Before gdb 13 the locations of a breakpoint follow it
+				//  without a name, bkpt={...},{...}
+				value, err = p.tuple()
+			} else {
+				name, value, err = p.result()
+			}
+			if err != nil {
+				return nil, err
+			}
+			add(record.results, repeated, name, value)
+		}
+	default:
+		return nil, errors.New("Not a record: " + line)
+	}
+
+	if p.pos != len(p.s) {
+		return nil, errors.New("Unexpected text after the record: " + line)
+	}
+	return record, nil
+}
+
+// add puts a value in a tuple, gathering the values of a repeated name.
+func add(tuple map[string]interface{}, repeated map[string]bool, name string, value interface{}) {
+	existing, ok := tuple[name]
+	switch {
+	case !ok:
+		tuple[name] = value
+	case repeated[name]:
+		tuple[name] = append(existing.([]interface{}), value)
+	default:
+		tuple[name] = []interface{}{existing, value}
+		repeated[name] = true
+	}
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) expect(c byte) error {
+	if p.pos >= len(p.s) || p.s[p.pos] != c {
+		return errors.New("Expected " + string(c) + " at " + strconv.Itoa(p.pos) + " of " + p.s)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.s) {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// result parses name=value.
+func (p *parser) result() (string, interface{}, error) {
+	end := strings.IndexByte(p.s[p.pos:], '=')
+	if end <= 0 {
+		return "", nil, errors.New("Expected a name at " + strconv.Itoa(p.pos) + " of " + p.s)
+	}
+	name := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+
+	value, err := p.value()
+	return name, value, err
+}
+
+func (p *parser) value() (interface{}, error) {
+	switch p.peek() {
+	case '"':
+		return p.cstring()
+	case '{':
+		return p.tuple()
+	case '[':
+		return p.list()
+	}
+	return nil, errors.New("Expected a value at " + strconv.Itoa(p.pos) + " of " + p.s)
+}
+
+func (p *parser) tuple() (interface{}, error) {
+	p.pos++
+	tuple := make(map[string]interface{})
+	repeated := make(map[string]bool)
+
+	if p.peek() == '}' {
+		p.pos++
+		return tuple, nil
+	}
+
+	for {
+		name, value, err := p.result()
+		if err != nil {
+			return nil, err
+		}
+		add(tuple, repeated, name, value)
+
+		if p.peek() == '}' {
+			p.pos++
+			return tuple, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// list parses both lists of values and lists of results. gdb mixes the
+// two for breakpoints with several locations.
+func (p *parser) list() (interface{}, error) {
+	p.pos++
+	list := []interface{}{}
+
+	if p.peek() == ']' {
+		p.pos++
+		return list, nil
+	}
+
+	for {
+		var value interface{}
+		var err error
+
+		switch p.peek() {
+		case '"', '{', '[':
+			value, err = p.value()
+		default:
+			_, value, err = p.result()
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cstring parses a C string. gdb escapes bytes that aren't printable in
+// octal.
+func (p *parser) cstring() (string, error) {
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+
+	var text []byte
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+
+		switch c {
+		case '"':
+			return string(text), nil
+		case '\\':
+			if p.pos >= len(p.s) {
+				return "", errors.New("Unterminated string in " + p.s)
+			}
+			c = p.s[p.pos]
+			p.pos++
+
+			switch c {
+			case 'n':
+				text = append(text, '\n')
+			case 't':
+				text = append(text, '\t')
+			case 'r':
+				text = append(text, '\r')
+			case 'f':
+				text = append(text, '\f')
+			case 'v':
+				text = append(text, '\v')
+			case 'a':
+				text = append(text, '\a')
+			case 'b':
+				text = append(text, '\b')
+			case 'e':
+				text = append(text, 0x1b)
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := int(c - '0')
+				for i := 0; i < 2 && p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '7'; i++ {
+					n = n*8 + int(p.s[p.pos]-'0')
+					p.pos++
+				}
+				text = append(text, byte(n))
+			default:
+				text = append(text, c)
+			}
+		default:
+			text = append(text, c)
+		}
+	}
+
+	return "", errors.New("Unterminated string in " + p.s)
+}
+
+// quote makes a C string of a command parameter if it needs to be one.
+func quote(parameter string) string {
+	if parameter != "" && !strings.ContainsAny(parameter, " \t\n\r\"\\'") {
+		return parameter
+	}
+
+	quoted := []byte{'"'}
+	for i := 0; i < len(parameter); i++ {
+		switch c := parameter[i]; c {
+		case '"', '\\':
+			quoted = append(quoted, '\\', c)
+		case '\n':
+			quoted = append(quoted, '\\', 'n')
+		case '\t':
+			quoted = append(quoted, '\\', 't')
+		case '\r':
+			quoted = append(quoted, '\\', 'r')
+		default:
+			quoted = append(quoted, c)
+		}
+	}
+	return string(append(quoted, '"'))
+}
@@ -0,0 +1,123 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseRecordTests = []struct {
+	line   string
+	record *outputRecord
+}{
+	{`*stopped,reason="breakpoint-hit",disp="keep",bkptno="1",frame={addr="0x0000000000401000",func="main.main",args=[],file="main.go",fullname="/src/main.go",line="12"},thread-id="1",stopped-threads="all",core="0"` + "\n",
+		&outputRecord{kind: '*', class: "stopped", results: map[string]interface{}{
+			"reason": "breakpoint-hit", "disp": "keep", "bkptno": "1",
+			"frame": map[string]interface{}{"addr": "0x0000000000401000", "func": "main.main", "args": []interface{}{},
+				"file": "main.go", "fullname": "/src/main.go", "line": "12"},
+			"thread-id": "1", "stopped-threads": "all", "core": "0"}}},
+	{`12^done,BreakpointTable={nr_rows="1",hdr=[{width="7",col_name="number"}],body=[bkpt={number="1",type="breakpoint",thread-groups=["i1"],times="0"}]}`,
+		&outputRecord{token: "12", kind: '^', class: "done", results: map[string]interface{}{
+			"BreakpointTable": map[string]interface{}{"nr_rows": "1",
+				"hdr": []interface{}{map[string]interface{}{"width": "7", "col_name": "number"}},
+				"body": []interface{}{map[string]interface{}{"number": "1", "type": "breakpoint",
+					"thread-groups": []interface{}{"i1"}, "times": "0"}}}}}},
+	// A breakpoint with several locations lists them after it
+	{`=breakpoint-modified,bkpt={number="1",addr="<MULTIPLE>"},{number="1.1",addr="0x1"},{number="1.2",addr="0x2"}`,
+		&outputRecord{kind: '=', class: "breakpoint-modified", results: map[string]interface{}{
+			"bkpt": []interface{}{map[string]interface{}{"number": "1", "addr": "<MULTIPLE>"},
+				map[string]interface{}{"number": "1.1", "addr": "0x1"}, map[string]interface{}{"number": "1.2", "addr": "0x2"}}}}},
+	{`^done,body=[bkpt={number="1",addr="<MULTIPLE>"},{number="1.1",addr="0x1"}]`,
+		&outputRecord{kind: '^', class: "done", results: map[string]interface{}{
+			"body": []interface{}{map[string]interface{}{"number": "1", "addr": "<MULTIPLE>"},
+				map[string]interface{}{"number": "1.1", "addr": "0x1"}}}}},
+	{`3^done,thread-ids={thread-id="2",thread-id="1",thread-id="3"},current-thread-id="1",number-of-threads="3"`,
+		&outputRecord{token: "3", kind: '^', class: "done", results: map[string]interface{}{
+			"thread-ids":        map[string]interface{}{"thread-id": []interface{}{"2", "1", "3"}},
+			"current-thread-id": "1", "number-of-threads": "3"}}},
+	{`=thread-group-added,id="i1"`,
+		&outputRecord{kind: '=', class: "thread-group-added", results: map[string]interface{}{"id": "i1"}}},
+	{`^running`, &outputRecord{kind: '^', class: "running", results: map[string]interface{}{}}},
+	{`~"Breakpoint 1 at 0x401000: file main.go, line 12.\n"`,
+		&outputRecord{kind: '~', text: "Breakpoint 1 at 0x401000: file main.go, line 12.\n"}},
+	{`&"warning: \"x\" is\tnot \\ here\r\n"`, &outputRecord{kind: '&', text: "warning: \"x\" is\tnot \\ here\r\n"}},
+	{`@"caf\303\251\0"`, &outputRecord{kind: '@', text: "caf\xc3\xa9\x00"}},
+	{`5^error,msg="No symbol \"foo\" in current context."`,
+		&outputRecord{token: "5", kind: '^', class: "error", results: map[string]interface{}{
+			"msg": `No symbol "foo" in current context.`}}},
+
+	// Output of the program that shares gdb's output isn't a record
+	{"hello world\n", nil},
+	{``, nil},
+	{`^`, nil},
+	{`^done,`, nil},
+	{`^done,msg="unterminated`, nil},
+	{`^done,msg="x"extra`, nil},
+	{`^done,value=x`, nil},
+	{`^done,frame={addr="0x1"`, nil},
+	{`^done,{addr="0x1"}`, nil},
+	{`4~"streams have no token"`, nil},
+	{`~"text"extra`, nil},
+}
+
+func TestParseRecord(t *testing.T) {
+	for _, test := range parseRecordTests {
+		record, err := parseRecord(test.line)
+		if test.record == nil {
+			if err == nil {
+				t.Errorf("parseRecord(%q) = %+v, want an error", test.line, record)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseRecord(%q) gave an error: %v", test.line, err)
+		} else if !reflect.DeepEqual(record, test.record) {
+			t.Errorf("parseRecord(%q) = %+v, want %+v", test.line, record, test.record)
+		}
+	}
+}
+
+func TestIsPrompt(t *testing.T) {
+	if !isPrompt("(gdb) \n") {
+		t.Errorf("isPrompt did not recognise the prompt")
+	}
+	if isPrompt(`~"(gdb) "`) {
+		t.Errorf("isPrompt took console output for the prompt")
+	}
+}
+
+var quoteTests = []struct {
+	parameter string
+	quoted    string
+}{
+	{"main.go:12", "main.go:12"},
+	{"--all-values", "--all-values"},
+	{"", `""`},
+	{"x == 1", `"x == 1"`},
+	{`say "hi"`, `"say \"hi\""`},
+	{`C:\src`, `"C:\\src"`},
+	{"a\tb\n", `"a\tb\n"`},
+	{"'c'", `"'c'"`},
+}
+
+func TestQuote(t *testing.T) {
+	for _, test := range quoteTests {
+		quoted := quote(test.parameter)
+		if quoted != test.quoted {
+			t.Errorf("quote(%q) = %s, want %s", test.parameter, quoted, test.quoted)
+		}
+
+		// gdb reads the parameter back as it was given
+		p := &parser{s: quoted}
+		if quoted[0] == '"' {
+			parameter, err := p.cstring()
+			if err != nil || parameter != test.parameter {
+				t.Errorf("quote(%q) reads back as %q, %v", test.parameter, parameter, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package gdblib
+
+import (
+	"errors"
+	"os"
+)
+
+// openPty isn't supported here so the program shares gdb's terminal.
+func openPty() (master *os.File, slave *os.File, err error) {
+	return nil, nil, errors.New("Pseudo terminals are not supported on this platform")
+}
@@ -0,0 +1,102 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+type ThreadSelectParms struct {
+	ThreadId string
+}
+
+type ThreadInfoParms struct {
+	// All of the threads if this is empty
+	ThreadId string
+}
+
+type StackListFramesParms struct {
+	// The selected thread if this is empty
+	ThreadId string
+}
+
+type StackListVariablesParms struct {
+	// The selected thread and frame if these are empty
+	Thread string
+	Frame  string
+	// Give the values of aggregates and not only of simple types
+	AllValues bool
+}
+
+type StackSelectFrameParms struct {
+	Frame string
+}
+
+// ThreadListIdsResult lists the ids of the threads. gdb repeats the
+// thread-id name for each one so they are gathered up here.
+type ThreadListIdsResult struct {
+	ThreadIds       []string `json:"thread-ids"`
+	CurrentThreadId string   `json:"current-thread-id"`
+	NumberOfThreads string   `json:"number-of-threads"`
+}
+
+func (g *GDB) ThreadListIds() (*ThreadListIdsResult, error) {
+	result, err := g.send("-thread-list-ids")
+	if err != nil {
+		return nil, err
+	}
+
+	ids := &ThreadListIdsResult{ThreadIds: []string{}}
+	ids.CurrentThreadId, _ = result["current-thread-id"].(string)
+	ids.NumberOfThreads, _ = result["number-of-threads"].(string)
+
+	tuple, _ := result["thread-ids"].(map[string]interface{})
+	switch threads := tuple["thread-id"].(type) {
+	case string:
+		ids.ThreadIds = append(ids.ThreadIds, threads)
+	case []interface{}:
+		for _, id := range threads {
+			if id, ok := id.(string); ok {
+				ids.ThreadIds = append(ids.ThreadIds, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func (g *GDB) ThreadSelect(parms ThreadSelectParms) (Result, error) {
+	return g.send("-thread-select", parms.ThreadId)
+}
+
+func (g *GDB) ThreadInfo(parms ThreadInfoParms) (Result, error) {
+	if parms.ThreadId == "" {
+		return g.send("-thread-info")
+	}
+	return g.send("-thread-info", parms.ThreadId)
+}
+
+func (g *GDB) StackInfoFrame() (Result, error) {
+	return g.send("-stack-info-frame")
+}
+
+func (g *GDB) StackListFrames(parms StackListFramesParms) (Result, error) {
+	return g.send("-stack-list-frames", threadParameters(parms.ThreadId, false)...)
+}
+
+func (g *GDB) StackListVariables(parms StackListVariablesParms) (Result, error) {
+	parameters := threadParameters(parms.Thread, false)
+	if parms.Frame != "" {
+		parameters = append(parameters, "--frame", parms.Frame)
+	}
+	if parms.AllValues {
+		parameters = append(parameters, "--all-values")
+	} else {
+		parameters = append(parameters, "--simple-values")
+	}
+
+	return g.send("-stack-list-variables", parameters...)
+}
+
+func (g *GDB) StackSelectFrame(parms StackSelectFrameParms) error {
+	_, err := g.send("-stack-select-frame", parms.Frame)
+	return err
+}
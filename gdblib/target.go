@@ -0,0 +1,52 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+type TargetAttachParms struct {
+	Pid string
+}
+
+type TargetDetachParms struct {
+	// The process being debugged if this is empty
+	Pid string
+}
+
+type TargetSelectParms struct {
+	// Such as core or remote
+	Type       string
+	Parameters string
+}
+
+type InterpreterExecParms struct {
+	// Such as console
+	Interpreter string
+	Command     string
+}
+
+func (g *GDB) TargetAttach(parms TargetAttachParms) error {
+	_, err := g.send("-target-attach", parms.Pid)
+	return err
+}
+
+func (g *GDB) TargetDetach(parms TargetDetachParms) error {
+	if parms.Pid == "" {
+		_, err := g.send("-target-detach")
+		return err
+	}
+	_, err := g.send("-target-detach", parms.Pid)
+	return err
+}
+
+func (g *GDB) TargetSelect(parms TargetSelectParms) error {
+	_, err := g.send("-target-select", parms.Type, parms.Parameters)
+	return err
+}
+
+// InterpreterExec runs a command in another interpreter, its output comes
+// through the channels like any other.
+func (g *GDB) InterpreterExec(parms InterpreterExecParms) error {
+	_, err := g.send("-interpreter-exec", parms.Interpreter, parms.Command)
+	return err
+}
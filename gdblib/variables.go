@@ -0,0 +1,121 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdblib
+
+import (
+	"strconv"
+)
+
+type VarCreateParms struct {
+	// gdb makes up a name if this is empty
+	Name string
+	// The selected frame if this is empty
+	FrameAddr  string
+	Expression string
+}
+
+type VarDeleteParms struct {
+	Name string
+}
+
+type VarListChildrenParms struct {
+	Name      string
+	AllValues bool
+	// Only list the children from From up to To, all of them if both are
+	//  zero
+	From int
+	To   int
+}
+
+type VarInfoNumChildrenParms struct {
+	Name string
+}
+
+type VarInfoTypeParms struct {
+	Name string
+}
+
+type VarAssignParms struct {
+	Name       string
+	Expression string
+}
+
+type VarUpdateParms struct {
+	// Every variable object if this is *
+	Name      string
+	AllValues bool
+}
+
+type VarSetFormatParms struct {
+	Name string
+	// One of natural, binary, decimal, hexadecimal, octal or
+	//  zero-hexadecimal
+	FormatSpec string
+}
+
+type VarSetVisualizerParms struct {
+	Name string
+	// A Python function that gives the pretty printer, None for none
+	Visualizer string
+}
+
+func (g *GDB) VarCreate(parms VarCreateParms) (Result, error) {
+	name := parms.Name
+	if name == "" {
+		name = "-"
+	}
+	frame := parms.FrameAddr
+	if frame == "" {
+		frame = "*"
+	}
+
+	return g.send("-var-create", name, frame, parms.Expression)
+}
+
+func (g *GDB) VarDelete(parms VarDeleteParms) error {
+	_, err := g.send("-var-delete", parms.Name)
+	return err
+}
+
+func (g *GDB) VarListChildren(parms VarListChildrenParms) (Result, error) {
+	parameters := []string{}
+	if parms.AllValues {
+		parameters = append(parameters, "--all-values")
+	}
+	parameters = append(parameters, parms.Name)
+	if parms.From != 0 || parms.To != 0 {
+		parameters = append(parameters, strconv.Itoa(parms.From), strconv.Itoa(parms.To))
+	}
+
+	return g.send("-var-list-children", parameters...)
+}
+
+func (g *GDB) VarInfoNumChildren(parms VarInfoNumChildrenParms) (Result, error) {
+	return g.send("-var-info-num-children", parms.Name)
+}
+
+func (g *GDB) VarInfoType(parms VarInfoTypeParms) (Result, error) {
+	return g.send("-var-info-type", parms.Name)
+}
+
+func (g *GDB) VarAssign(parms VarAssignParms) (Result, error) {
+	return g.send("-var-assign", parms.Name, parms.Expression)
+}
+
+func (g *GDB) VarUpdate(parms VarUpdateParms) (Result, error) {
+	if parms.AllValues {
+		return g.send("-var-update", "--all-values", parms.Name)
+	}
+	return g.send("-var-update", parms.Name)
+}
+
+func (g *GDB) VarSetFormat(parms VarSetFormatParms) (Result, error) {
+	return g.send("-var-set-format", parms.Name, parms.FormatSpec)
+}
+
+func (g *GDB) VarSetVisualizer(parms VarSetVisualizerParms) error {
+	_, err := g.send("-var-set-visualizer", parms.Name, parms.Visualizer)
+	return err
+}
@@ -0,0 +1,5 @@
+module github.com/sirnewton01/godbg
+
+go 1.18
+
+require golang.org/x/net v0.19.0
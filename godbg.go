@@ -11,7 +11,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"github.com/sirnewton01/gdblib"
+	"github.com/sirnewton01/godbg/gdblib"
 	"go/build"
 	"io"
 	"log"
@@ -19,7 +19,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -59,13 +58,26 @@ const (
 )
 
 var (
-	srcDir    *string
-	autoOpen  *bool
-	gopath    string
-	gopaths   []string
-	goroot    string
-	cwd       string
-	bundleDir string
+	srcDir       *string
+	autoOpen     *bool
+	idleTimeout  *time.Duration
+	dapAddr      *string
+	backend      *string
+	bundleDir    *string
+	breakOnPanic *bool
+	signals      *string
+
+	buildTags    *string
+	buildRace    *bool
+	buildLdflags *string
+
+	gopath  string
+	gopaths []string
+	goroot  string
+	cwd     string
+
+	// Source directory of the package when debugging its tests
+	testPkgDir string
 
 	magicKey string
 	hostName string = loopbackHost
@@ -75,28 +87,29 @@ var (
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] <executable|go package name> [arguments...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <executable|go package> [arguments...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] attach <pid> [executable]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] core <executable> <core file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s [options] test [go package] [-run regexp] [-v] [-list] [test arguments...]\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	srcDir = flag.String("srcDir", "", "Location of the source code for the executable")
 	autoOpen = flag.Bool("openBrowser", true, "Automatically open a web browser when possible")
-
-	flag.Parse()
+	buildTags = flag.String("tags", "", "Build tags to use when compiling a package")
+	buildRace = flag.Bool("race", false, "Enable the race detector when compiling a package")
+	buildLdflags = flag.String("ldflags", "", "Extra linker flags to use when compiling a package")
+	bundleDir = flag.String("bundles", "", "Serve the web bundles from this directory in preference to the built-in ones")
+	backend = flag.String("backend", "gdb", "Debugger to drive, either gdb or dlv (Delve)")
+	dapAddr = flag.String("dap", "", "Speak the Debug Adapter Protocol on \"stdio\" or a TCP address such as \":4711\" instead of serving the web UI")
+	signals = flag.String("signals", "", "Signal handling on top of the Go defaults, such as \"SIGPIPE=stop SIGUSR1=nostop,noprint\" (actions are stop, nostop, print, noprint, pass and nopass)")
+	breakOnPanic = flag.Bool("breakOnPanic", true, "Stop when the program panics or hits a fatal runtime error")
+	idleTimeout = flag.Duration("idleTimeout", 0, "End the debug session after no browser has been connected for this long (0 means never)")
 
 	gopath = build.Default.GOPATH
 	goroot = runtime.GOROOT()
 	cwd, _ = os.Getwd()
 
-	// Search gopaths for the bundles directory for our web bundles
 	gopaths = strings.Split(gopath, string(filepath.ListSeparator))
-	for _, path := range gopaths {
-		pathToMatch := filepath.Join(path, "/src/github.com/sirnewton01/godbg/bundles")
-
-		_, err := os.Stat(pathToMatch)
-		if err == nil {
-			bundleDir = pathToMatch
-		}
-	}
 
 	if os.Getenv("GOHOST") != "" {
 		hostName = os.Getenv("GOHOST")
@@ -117,157 +130,222 @@ func init() {
 }
 
 func main() {
-	if bundleDir == "" {
-		log.Fatal("Please set the GOPATH that includes the godbg project and re-run.")
-		return
+	// Parsed here rather than in init so that the package can be tested
+	flag.Parse()
+
+	// Exiting skips deferred calls so it happens once run has cleaned up
+	os.Exit(run())
+}
+
+// run debugs the program named on the command line and gives the exit
+// status of godbg.
+func run() int {
+	if *dapAddr == "stdio" {
+		reserveStdout()
 	}
 
 	if flag.NArg() < 1 {
 		flag.Usage()
-		return
+		return 0
 	}
 
 	execPath := flag.Arg(0)
 
-	// Check to see if the executable path is really a go package that
-	//  exists in the gopath's source directory
-	if !filepath.IsAbs(execPath) {
-		pkgPath := execPath
-		pkgSrcDir := ""
-		pkgBase := filepath.Base(pkgPath)
+	debugBuilder := &builder{tags: *buildTags, race: *buildRace, ldflags: *buildLdflags}
+	defer debugBuilder.cleanup()
 
-		for _, path := range gopaths {
-			srcPathMatch := filepath.Join(path, "src", pkgPath)
-			binPathMatch := filepath.Join(path, "bin", pkgBase)
+	execArgs := flag.Args()[1:]
+	target := debugTarget{}
 
-			// Try to discover the src location and delete any existing binaries
-			//  for this packages
-			_, err := os.Stat(srcPathMatch)
-			if err == nil {
-				pkgSrcDir = srcPathMatch
-				if *srcDir == "" {
-					srcDir = &pkgSrcDir
-				}
+	if execPath == "core" {
+		// Examine a core dump of the executable
+		if len(execArgs) != 2 {
+			flag.Usage()
+			return 2
+		}
 
-				_, err = os.Stat(binPathMatch)
-				execPath = binPathMatch
+		execPath = execArgs[0]
+		target.corePath = execArgs[1]
+		execArgs = nil
+	} else if execPath == "attach" {
+		// Attach to a running process rather than launching one
+		if len(execArgs) < 1 {
+			flag.Usage()
+			return 2
+		}
 
-				if err == nil {
-					os.Remove(execPath)
+		pid, err := strconv.Atoi(execArgs[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid process id: %v\n", execArgs[0])
+			return 2
+		}
+		target.pid = pid
 
-					execFile, _ := os.Open(execPath)
-					if execFile != nil {
-						_, err := execFile.Stat()
-						if err == nil {
-							fmt.Fprintf(os.Stderr, "Could not clean existing binary in order to recompile with debug flags. %v\n", execPath)
-							os.Exit(1)
-						}
-					}
+		if len(execArgs) > 1 {
+			execPath = execArgs[1]
+		} else {
+			execPath, err = processExecutable(pid)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+		}
+		execArgs = nil
+	} else if execPath == "test" {
+		// Debug the test binary of a package
+		pkgPath, list, testArgs, err := parseTestArgs(execArgs)
+		if err != nil {
+			return 2
+		}
+
+		if list {
+			pkgSrcDir, err := packageDir(pkgPath)
+			if err == nil {
+				var tests []string
+				tests, err = listTests(pkgSrcDir)
+				for _, test := range tests {
+					fmt.Printf("%v\n", test)
 				}
 			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return 1
+			}
+			return 0
+		}
 
-			// Delete the "pkg" directory with any lingering archives
-			os.RemoveAll(filepath.Join(path, "pkg"))
+		execPath, testPkgDir, err = debugBuilder.buildTest(pkgPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not compile test binary with debug flags: %v\n%v\n", pkgPath, err)
+			return 1
 		}
 
-		cmd := exec.Command("go", "install", "-gcflags", "-N -l", pkgPath)
-		msg, err := cmd.CombinedOutput()
+		if *srcDir == "" {
+			srcDir = &testPkgDir
+		}
+		execArgs = testArgs
+	} else if info, err := os.Stat(execPath); err != nil || info.IsDir() {
+		// Anything other than an existing file is a package pattern (e.g. "." or
+		//  an import path) to compile with debug flags
+		pkgPath := execPath
+		pkgSrcDir := ""
+
+		execPath, pkgSrcDir, err = debugBuilder.build(pkgPath)
 		if err != nil {
-			fmt.Printf("Could not compile binary with debug flags: %v\n%v\n", pkgPath, string(msg))
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Could not compile binary with debug flags: %v\n%v\n", pkgPath, err)
+			return 1
+		}
+
+		if *srcDir == "" {
+			srcDir = &pkgSrcDir
 		}
 	}
 
-	mygdb, err := gdblib.NewGDB(execPath, *srcDir)
+	target.execPath = execPath
+	target.srcDir = *srcDir
+
+	mygdb, err := newDebugger(*backend, target)
 	if err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "Could not start the debugger: %v\n", err)
+		return 1
 	}
 
+	// There is nothing to execute in a core dump, only to inspect
+	mysession := newSession(mygdb, *idleTimeout, target.corePath != "")
+
+	if *breakOnPanic && !mysession.readOnly {
+		mysession.catchPanics()
+	}
+
+	if myhandler, ok := mygdb.(signalHandler); ok && !mysession.readOnly {
+		err = mysession.signals.configure(myhandler, goSignalDefaults+" "+*signals)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not configure signal handling: %v\n", err)
+		}
+	}
+
+	if target.launches() {
+		mygdb.ExecArgs(execArgs)
+	}
+
+	if *dapAddr != "" {
+		dapServer := newDapServer(mysession)
+		go dapServer.listen(*dapAddr)
+
+		// Give the editor a chance to set its breakpoints before the program starts
+		<-dapServer.configured
+	} else {
+		// Editors keep their own breakpoints so only the web UI restores them
+		if target.corePath == "" {
+			mysession.restore(stateFile(target.srcDir))
+		}
+
+		serveWeb(mygdb, mysession)
+	}
+
+	if target.launches() {
+		mygdb.ExecRun(gdblib.ExecRunParms{})
+	}
+
+	err = mygdb.Wait()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// serveWeb starts the web UI for the session and points the user's browser at it.
+func serveWeb(mygdb Debugger, mysession *session) {
 	serverAddrChan := make(chan string)
 
 	go func() {
-		file, _ := os.Open(bundleDir)
-		bundleNames, _ := file.Readdirnames(-1)
-		bundleFileSystems := make([]http.FileSystem, len(bundleNames), len(bundleNames))
-		for idx, bundleName := range bundleNames {
-			bundleFileSystems[idx] = http.Dir(filepath.Join(bundleDir, bundleName, "web"))
+		cfs, err := bundleFileSystem(*bundleDir)
+		if err != nil {
+			panic(err)
 		}
-		cfs := chainedFileSystem{fs: bundleFileSystems}
 
 		http.HandleFunc("/", wrapFileServer(http.FileServer(cfs)))
 
-		http.HandleFunc("/output", wrapWebSocket(websocket.Handler(func(ws *websocket.Conn) {
-			type webSockResult struct {
-				Type string
-				Data interface{}
-			}
-
-			for {
-				select {
-				case data := <-mygdb.Console:
-					bytes, err := json.Marshal(&webSockResult{Type: "console", Data: data})
-					if err == nil {
-						_, err := ws.Write(bytes)
-						if err != nil {
-							fmt.Printf("Client disconnect\n")
-							mygdb.GdbExit()
-						}
-					}
-					// TODO log the marshalling error
-				case data := <-mygdb.Target:
-					bytes, err := json.Marshal(&webSockResult{Type: "target", Data: data})
-					if err == nil {
-						_, err := ws.Write(bytes)
-						if err != nil {
-							fmt.Printf("Client disconnect\n")
-							mygdb.GdbExit()
-						}
-					}
-					// TODO log the marshalling error
-				case data := <-mygdb.InternalLog:
-					bytes, err := json.Marshal(&webSockResult{Type: "gdb", Data: data})
-					if err == nil {
-						_, err := ws.Write(bytes)
-						if err != nil {
-							fmt.Printf("Client disconnect\n")
-							mygdb.GdbExit()
-						}
-					}
-					// TODO log the marshalling error
-				case record := <-mygdb.AsyncResults:
-					bytes, err := json.Marshal(&webSockResult{Type: "async", Data: record})
-					if err == nil {
-						_, err := ws.Write(bytes)
-						if err != nil {
-							fmt.Printf("Client disconnect\n")
-							mygdb.GdbExit()
-						}
-					}
-					// TODO log the marshalling error
-				case <-time.After(30 * time.Second):
-					// Send heartbeat and disconnect if client doesn't receive it
-					bytes, err := json.Marshal(&webSockResult{Type: "heartbeat", Data: ""})
-					if err == nil {
-						_, err := ws.Write(bytes)
-						if err != nil {
-							fmt.Printf("Client disconnect\n")
-							mygdb.GdbExit()
-						}
-					}
-					// TODO log the marshalling error
-				}
-			}
-		})))
+		http.HandleFunc("/output", wrapWebSocket(websocket.Handler(mysession.serve)))
 
 		// Add handlers for each category of gdb commands (exec, breakpoint, thread, etc.)
-		addExecHandlers(mygdb)
-		addBreakpointHandlers(mygdb)
+		if mysession.readOnly {
+			http.HandleFunc("/handle/exec/", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(403)
+				w.Write([]byte("Execution control is disabled in a read-only session"))
+			}))
+		} else {
+			addExecHandlers(mygdb)
+		}
+		addBreakpointHandlers(mysession)
 		addThreadHandlers(mygdb)
 		addFrameHandlers(mygdb)
-		addVariableHandlers(mygdb)
+		addDisassembleHandlers(mygdb)
+		addRegisterHandlers(mygdb, mysession.readOnly)
+		addMemoryHandlers(mygdb, mysession.readOnly)
+		addVariableHandlers(mysession)
+		addSessionHandlers(mysession)
+		addPersistenceHandlers(mysession)
+
+		if myhandler, ok := mygdb.(signalHandler); ok {
+			addSignalHandlers(myhandler, mysession)
+		}
+
+		if mycatcher, ok := mygdb.(catcher); ok {
+			addCatchHandlers(mycatcher, mysession)
+		}
+
+		if myattacher, ok := mygdb.(attacher); ok && !mysession.readOnly {
+			addProcessHandlers(myattacher)
+		}
+
+		if testPkgDir != "" {
+			addTestHandlers(testPkgDir)
+		}
 
 		http.HandleFunc("/handle/gdb/exit", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			mygdb.GdbExit()
+			mygdb.Exit()
 		}))
 
 		// Unsecure local connection through the loopback interface
@@ -319,15 +397,6 @@ func main() {
 			fmt.Printf("%v\n", url)
 		}
 	}()
-
-	execArgs := flag.Args()[1:]
-	mygdb.ExecArgs(gdblib.ExecArgsParms{strings.Join(execArgs, " ")})
-	mygdb.ExecRun(gdblib.ExecRunParms{})
-
-	err = mygdb.Wait()
-	if err != nil {
-		panic(err)
-	}
 }
 
 type handlerFunc func(http.ResponseWriter, *http.Request)
@@ -418,7 +487,7 @@ func wrapFileServer(delegate http.Handler) handlerFunc {
 	}
 }
 
-func addThreadHandlers(mygdb *gdblib.GDB) {
+func addThreadHandlers(mygdb Debugger) {
 	http.HandleFunc("/handle/thread/listids", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		result, err := mygdb.ThreadListIds()
 
@@ -500,7 +569,7 @@ func addThreadHandlers(mygdb *gdblib.GDB) {
 	}))
 }
 
-func addFrameHandlers(mygdb *gdblib.GDB) {
+func addFrameHandlers(mygdb Debugger) {
 	http.HandleFunc("/handle/frame/stackinfo", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		result, err := mygdb.StackInfoFrame()
 
@@ -639,7 +708,7 @@ func addFrameHandlers(mygdb *gdblib.GDB) {
 	}))
 }
 
-func addExecHandlers(mygdb *gdblib.GDB) {
+func addExecHandlers(mygdb Debugger) {
 	http.HandleFunc("/handle/exec/next", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		parms := gdblib.ExecNextParms{}
 
@@ -676,6 +745,42 @@ func addExecHandlers(mygdb *gdblib.GDB) {
 		w.WriteHeader(200)
 	}))
 
+	http.HandleFunc("/handle/exec/nexti", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.ExecNextInstructionParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil {
+			err = mygdb.ExecNextInstruction(parms)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/exec/stepi", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.ExecStepInstructionParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil {
+			err = mygdb.ExecStepInstruction(parms)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
 	http.HandleFunc("/handle/exec/continue", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		parms := gdblib.ExecContinueParms{}
 
@@ -713,13 +818,16 @@ func addExecHandlers(mygdb *gdblib.GDB) {
 	}))
 
 	http.HandleFunc("/handle/exec/args", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		parms := gdblib.ExecArgsParms{}
+		parms := struct {
+			// One entry for each argument, with no quoting
+			Args []string
+		}{}
 
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&parms)
 
 		if err == nil {
-			err = mygdb.ExecArgs(parms)
+			err = mygdb.ExecArgs(parms.Args)
 		}
 
 		if err != nil {
@@ -736,20 +844,134 @@ func addExecHandlers(mygdb *gdblib.GDB) {
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&parms)
 
-		mygdb.ExecInterrupt(parms)
+		if err != nil && err != io.EOF {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// The outcome of the interrupt comes as a stopped record
+		err = mygdb.ExecInterrupt(parms)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/exec/finish", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.ExecFinishParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		// The return values come with the stopped record
+		if err == nil {
+			err = mygdb.ExecFinish(parms)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/exec/until", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.ExecUntilParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil {
+			err = mygdb.ExecUntil(parms)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/exec/jump", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.ExecJumpParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Jumping resumes the program so stop it again straight away at
+		//  the new location
+		result, err := mygdb.BreakInsert(gdblib.BreakInsertParms{Location: parms.Location, Temporary: true})
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		err = mygdb.ExecJump(parms)
 
 		if err != nil {
+			inserted := miBreakInsert{}
+			remarshal(result, &inserted)
+			mygdb.BreakDelete(gdblib.BreakDeleteParms{Breakpoints: []string{inserted.Bkpt.Number}})
+
 			w.WriteHeader(400)
 			w.Write([]byte(err.Error()))
 			return
 		}
 		w.WriteHeader(200)
 	}))
+
+	http.HandleFunc("/handle/exec/return", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.ExecReturnParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		result, err := mygdb.ExecReturn(parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(result)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
 }
 
-func addBreakpointHandlers(mygdb *gdblib.GDB) {
+func addBreakpointHandlers(mysession *session) {
+	mygdb := mysession.mygdb
+	mylogpoints := mysession.logpoints
+
 	http.HandleFunc("/handle/breakpoint/list", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		result, err := mygdb.BreakList()
+		result, err := listBreakpoints(mygdb, mylogpoints)
 
 		if err != nil {
 			w.WriteHeader(500)
@@ -788,6 +1010,8 @@ func addBreakpointHandlers(mygdb *gdblib.GDB) {
 			return
 		}
 
+		mysession.save()
+
 		resultBytes, err := json.Marshal(result)
 
 		if err != nil {
@@ -819,6 +1043,8 @@ func addBreakpointHandlers(mygdb *gdblib.GDB) {
 			return
 		}
 
+		mysession.save()
+
 		w.WriteHeader(200)
 	}))
 
@@ -842,13 +1068,237 @@ func addBreakpointHandlers(mygdb *gdblib.GDB) {
 			return
 		}
 
+		mysession.save()
+
 		w.WriteHeader(200)
 	}))
+
+	http.HandleFunc("/handle/breakpoint/delete", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.BreakDeleteParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		err = mygdb.BreakDelete(parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		mylogpoints.remove(parms.Breakpoints)
+		mysession.save()
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/breakpoint/condition", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.BreakConditionParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		err = mygdb.BreakCondition(parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		mysession.save()
+		writeBreakpoint(w, mygdb, mylogpoints, parms.Number)
+	}))
+
+	http.HandleFunc("/handle/breakpoint/ignore", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := gdblib.BreakAfterParms{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		err = mygdb.BreakAfter(parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		mysession.save()
+		writeBreakpoint(w, mygdb, mylogpoints, parms.Number)
+	}))
+
+	http.HandleFunc("/handle/watchpoint/insert", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			Expression string
+			// One of write (the default), read or access
+			Type string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		watchParms := gdblib.BreakWatchParms{Expression: parms.Expression}
+		switch parms.Type {
+		case "", "write":
+		case "read":
+			watchParms.Read = true
+		case "access":
+			watchParms.Access = true
+		default:
+			w.WriteHeader(400)
+			w.Write([]byte("Unknown watchpoint type " + parms.Type))
+			return
+		}
+
+		result, err := mygdb.BreakWatch(watchParms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		inserted := miBreakWatch{}
+		err = remarshal(result, &inserted)
+
+		if err != nil || inserted.watchpoint() == nil {
+			w.WriteHeader(500)
+			w.Write([]byte("Unexpected watchpoint result"))
+			return
+		}
+
+		writeBreakpoint(w, mygdb, mylogpoints, inserted.watchpoint().Number)
+	}))
+
+	http.HandleFunc("/handle/logpoint/insert", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			Location  string
+			Condition string
+			// Message to log, such as "n={len(buf)}"
+			Format string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil {
+			_, err = parseLogFormat(parms.Format)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		result, err := mygdb.BreakInsert(gdblib.BreakInsertParms{Location: parms.Location, Condition: parms.Condition})
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		inserted := miBreakInsert{}
+		err = remarshal(result, &inserted)
+
+		if err == nil {
+			err = mylogpoints.add(inserted.Bkpt.Number, parms.Format)
+		}
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		mysession.save()
+		writeBreakpoint(w, mygdb, mylogpoints, inserted.Bkpt.Number)
+	}))
+}
+
+// listBreakpoints lists the breakpoints of all kinds, including logpoints.
+func listBreakpoints(mygdb Debugger, mylogpoints *logpointTable) (*miBreakList, error) {
+	result, err := mygdb.BreakList()
+	if err != nil {
+		return nil, err
+	}
+
+	breakpoints := &miBreakList{}
+	err = remarshal(result, breakpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	mylogpoints.annotate(breakpoints)
+	return breakpoints, nil
+}
+
+// writeBreakpoint responds with the current bkpt record of a breakpoint
+// in the same form as an insert.
+func writeBreakpoint(w http.ResponseWriter, mygdb Debugger, mylogpoints *logpointTable, number string) {
+	breakpoints, err := listBreakpoints(mygdb, mylogpoints)
+
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	for _, bp := range breakpoints.BreakPointTable.Body {
+		if bp.Number == number {
+			resultBytes, err := json.Marshal(miBreakInsert{Bkpt: bp})
+
+			if err != nil {
+				w.WriteHeader(500)
+				w.Write([]byte(err.Error()))
+			} else {
+				w.WriteHeader(200)
+				w.Write(resultBytes)
+			}
+			return
+		}
+	}
+
+	w.WriteHeader(400)
+	w.Write([]byte("No breakpoint number " + number))
 }
 
-func addVariableHandlers(mygdb *gdblib.GDB) {
+func addVariableHandlers(mysession *session) {
+	mygdb := mysession.mygdb
+	myvarobjs := mysession.varobjs
+
 	http.HandleFunc("/handle/variable/create", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		parms := gdblib.VarCreateParms{}
+		parms := struct {
+			gdblib.VarCreateParms
+			// One of the varobjFormats, natural if empty
+			Format string
+		}{}
 
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&parms)
@@ -859,7 +1309,13 @@ func addVariableHandlers(mygdb *gdblib.GDB) {
 			return
 		}
 
-		result, err := mygdb.VarCreate(parms)
+		// Variable objects for a particular frame are left to the client
+		var result interface{}
+		if parms.Name == "" && parms.FrameAddr == "" {
+			result, err = myvarobjs.create(parms.Expression, parms.Format)
+		} else {
+			result, err = mygdb.VarCreate(parms.VarCreateParms)
+		}
 
 		if err != nil {
 			w.WriteHeader(500)
@@ -890,6 +1346,13 @@ func addVariableHandlers(mygdb *gdblib.GDB) {
 			return
 		}
 
+		// Other clients may be showing the registry's variable objects, they
+		//  are deleted once they go out of scope instead
+		if myvarobjs.owns(parms.Name) {
+			w.WriteHeader(200)
+			return
+		}
+
 		err = mygdb.VarDelete(parms)
 
 		if err != nil {
@@ -897,12 +1360,62 @@ func addVariableHandlers(mygdb *gdblib.GDB) {
 			w.Write([]byte(err.Error()))
 			return
 		}
+		myvarobjs.remove(parms.Name)
 
 		w.WriteHeader(200)
 	}))
 
 	http.HandleFunc("/handle/variable/listchildren", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		parms := gdblib.VarListChildrenParms{}
+		parms := struct {
+			gdblib.VarListChildrenParms
+			// Format for the children, they keep their own if empty
+			Format string
+			// Levels of children to list, only the first if zero
+			Depth int
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		switch {
+		case err != nil:
+		case parms.From < 0 || parms.To < 0:
+			err = errors.New("Expected a range of children from zero up")
+		case parms.Depth < 0 || parms.Depth > maxChildrenDepth:
+			err = errors.New("Can only list up to " + strconv.Itoa(maxChildrenDepth) + " levels of children at a time")
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		result, err := myvarobjs.listChildren(parms.VarListChildrenParms, parms.Format, parms.Depth)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(result)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	http.HandleFunc("/handle/variable/format", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			Name string
+			// One of the varobjFormats
+			Format string
+		}{}
 
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&parms)
@@ -913,11 +1426,56 @@ func addVariableHandlers(mygdb *gdblib.GDB) {
 			return
 		}
 
-		result, err := mygdb.VarListChildren(parms)
+		result, err := myvarobjs.setFormat(parms.Name, parms.Format)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(result)
 
 		if err != nil {
 			w.WriteHeader(500)
 			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	if mysession.readOnly {
+		return
+	}
+
+	http.HandleFunc("/handle/variable/assign", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			// Either a variable object or an expression to assign to
+			Name       string
+			Expression string
+			Value      string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil && parms.Name == "" && parms.Expression == "" {
+			err = errors.New("Expected a variable object or an expression")
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// The other clients see the new value through the registry
+		result, err := myvarobjs.assign(parms.Name, parms.Expression, parms.Value)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
 			return
 		}
 
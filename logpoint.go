@@ -0,0 +1,201 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// logpoint is a breakpoint that logs a message each time that it is hit
+// and then lets the program carry on. The message is a format such as
+// "req id={req.ID} n={len(buf)}" where each expression in braces is
+// evaluated in the frame that hit the breakpoint. Doubled braces stand
+// for literal ones.
+type logpoint struct {
+	format string
+	parts  []logpointPart
+	hits   int
+}
+
+type logpointPart struct {
+	text       string
+	expression bool
+}
+
+// logpointEvent is sent to the web clients each time a logpoint is hit.
+type logpointEvent struct {
+	Number   string
+	Message  string
+	Hits     int
+	ThreadId string
+	Frame    miFrame
+}
+
+// logpointTable holds the logpoints of a session keyed by breakpoint number.
+type logpointTable struct {
+	mutex     sync.Mutex
+	logpoints map[string]*logpoint
+}
+
+func newLogpointTable() *logpointTable {
+	return &logpointTable{logpoints: make(map[string]*logpoint)}
+}
+
+// parseLogFormat splits a logpoint format into its text and expressions.
+func parseLogFormat(format string) ([]logpointPart, error) {
+	parts := []logpointPart{}
+	text := ""
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		switch {
+		case (c == '{' || c == '}') && i+1 < len(format) && format[i+1] == c:
+			text += string(c)
+			i++
+		case c == '{':
+			// Expressions may contain braces of their own, composite literals for example
+			depth := 1
+			end := i + 1
+			for ; end < len(format) && depth > 0; end++ {
+				switch format[end] {
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+			}
+			if depth > 0 {
+				return nil, errors.New("Unclosed { in log message")
+			}
+
+			expression := strings.TrimSpace(format[i+1 : end-1])
+			if expression == "" {
+				return nil, errors.New("Empty {} in log message")
+			}
+
+			if text != "" {
+				parts = append(parts, logpointPart{text: text})
+				text = ""
+			}
+			parts = append(parts, logpointPart{text: expression, expression: true})
+			i = end - 1
+		case c == '}':
+			return nil, errors.New("Unexpected } in log message, use }} for a literal brace")
+		default:
+			text += string(c)
+		}
+	}
+
+	if text != "" {
+		parts = append(parts, logpointPart{text: text})
+	}
+	return parts, nil
+}
+
+func (t *logpointTable) add(number string, format string) error {
+	parts, err := parseLogFormat(format)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.logpoints[number] = &logpoint{format: format, parts: parts}
+	return nil
+}
+
+func (t *logpointTable) remove(numbers []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, number := range numbers {
+		delete(t.logpoints, number)
+	}
+}
+
+// stoppedAt reports the logpoint, if any, that a stop record is for.
+func (t *logpointTable) stoppedAt(record gdblib.AsyncResultRecord) (string, bool) {
+	if record.Indication != "stopped" {
+		return "", false
+	}
+
+	reason, _ := record.Result["reason"].(string)
+	number, _ := record.Result["bkptno"].(string)
+	if reason != "breakpoint-hit" {
+		return "", false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	_, ok := t.logpoints[number]
+	return number, ok
+}
+
+// hit counts a hit of a logpoint and returns the parts of its message.
+func (t *logpointTable) hit(number string) ([]logpointPart, int, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	lp, ok := t.logpoints[number]
+	if !ok {
+		return nil, 0, false
+	}
+
+	lp.hits++
+	return lp.parts, lp.hits, true
+}
+
+// annotate marks the logpoints in a breakpoint list with their message
+// and number of hits. Their times are the hits that were logged, gdb
+// counts every stop.
+func (t *logpointTable) annotate(breakpoints *miBreakList) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for idx := range breakpoints.BreakPointTable.Body {
+		bp := &breakpoints.BreakPointTable.Body[idx]
+
+		if lp, ok := t.logpoints[bp.Number]; ok {
+			bp.Type = "logpoint"
+			bp.What = lp.format
+			bp.Times = strconv.Itoa(lp.hits)
+		}
+	}
+}
+
+// renderLogMessage evaluates the expressions of a logpoint in the
+// current frame. Expressions that can't be evaluated show the error
+// rather than spoiling the whole message.
+func renderLogMessage(mygdb Debugger, parts []logpointPart) string {
+	message := ""
+
+	for _, part := range parts {
+		if !part.expression {
+			message += part.text
+			continue
+		}
+
+		result, err := mygdb.VarCreate(gdblib.VarCreateParms{Expression: part.text})
+		if err != nil {
+			message += "<" + err.Error() + ">"
+			continue
+		}
+
+		value := miVariable{}
+		remarshal(result, &value)
+		mygdb.VarDelete(gdblib.VarDeleteParms{Name: value.Name})
+
+		message += value.Value
+	}
+
+	return message
+}
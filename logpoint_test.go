@@ -0,0 +1,90 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func logText(s string) logpointPart { return logpointPart{text: s} }
+func logExpr(s string) logpointPart { return logpointPart{text: s, expression: true} }
+
+var parseLogFormatTests = []struct {
+	format string
+	parts  []logpointPart
+}{
+	{"", []logpointPart{}},
+	{"hello", []logpointPart{logText("hello")}},
+	{"n={n}", []logpointPart{logText("n="), logExpr("n")}},
+	{"req id={req.ID} n={len(buf)}", []logpointPart{logText("req id="), logExpr("req.ID"), logText(" n="), logExpr("len(buf)")}},
+	{"{a}{b}", []logpointPart{logExpr("a"), logExpr("b")}},
+	{"{ a }", []logpointPart{logExpr("a")}},
+	// Doubled braces are literal ones
+	{"{{literal}}", []logpointPart{logText("{literal}")}},
+	{"{{{x}}}", []logpointPart{logText("{"), logExpr("x"), logText("}")}},
+	{"{{}}", []logpointPart{logText("{}")}},
+	// Braces inside an expression nest
+	{"p={T{1, 2}}", []logpointPart{logText("p="), logExpr("T{1, 2}")}},
+	{"{T{a{}}} done", []logpointPart{logExpr("T{a{}}"), logText(" done")}},
+}
+
+func TestParseLogFormat(t *testing.T) {
+	for _, tt := range parseLogFormatTests {
+		parts, err := parseLogFormat(tt.format)
+		if err != nil {
+			t.Errorf("parseLogFormat(%q): %v", tt.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(parts, tt.parts) {
+			t.Errorf("parseLogFormat(%q) = %v, want %v", tt.format, parts, tt.parts)
+		}
+	}
+}
+
+var parseLogFormatErrors = []string{
+	"{",
+	"n={n",
+	"}",
+	"a}b",
+	"{a}}",
+	"{{x}",
+	"{}",
+	"{  }",
+	"{T{1, 2}",
+}
+
+func TestParseLogFormatErrors(t *testing.T) {
+	for _, format := range parseLogFormatErrors {
+		if parts, err := parseLogFormat(format); err == nil {
+			t.Errorf("parseLogFormat(%q) = %v, want an error", format, parts)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	table := newLogpointTable()
+	if err := table.add("2", "n={n}"); err != nil {
+		t.Fatal(err)
+	}
+	table.hit("2")
+	table.hit("2")
+	table.hit("3")
+
+	breakpoints := miBreakList{}
+	breakpoints.BreakPointTable.Body = []miBreakpoint{
+		{Number: "1", Type: "breakpoint", Times: "5"},
+		{Number: "2", Type: "breakpoint", Times: "7"},
+	}
+	table.annotate(&breakpoints)
+
+	want := []miBreakpoint{
+		{Number: "1", Type: "breakpoint", Times: "5"},
+		{Number: "2", Type: "logpoint", What: "n={n}", Times: "2"},
+	}
+	if !reflect.DeepEqual(breakpoints.BreakPointTable.Body, want) {
+		t.Errorf("annotate gave %+v, want %+v", breakpoints.BreakPointTable.Body, want)
+	}
+}
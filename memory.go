@@ -0,0 +1,289 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Bytes read at a time unless the client asks for some other amount
+	memoryPageSize = 256
+	// Most bytes that can be read at a time
+	maxMemoryPageSize = 64 * 1024
+	// Bytes shown on each line of a dump
+	memoryLineSize = 16
+)
+
+// memoryTypes are the types that memory can be read as along with their
+// sizes. Values are read in little endian order like on the
+// architectures that godbg is used with.
+var memoryTypes = map[string]int{
+	"int8": 1, "int16": 2, "int32": 4, "int64": 8,
+	"uint8": 1, "uint16": 2, "uint32": 4, "uint64": 8,
+	"float32": 4, "float64": 8, "pointer": 8,
+}
+
+type memoryLine struct {
+	Address string
+	Hex     string
+	ASCII   string
+}
+
+// memoryPage is one page of memory starting at Offset bytes from the
+// address that was asked for. NextOffset is where the page after it
+// starts. Bytes that can't be read are shown as ?? wherever they are in
+// the page.
+type memoryPage struct {
+	Address    string
+	Offset     int
+	NextOffset int
+	Lines      []memoryLine
+	// The bytes read as the type that was asked for, if any
+	Values []string `json:",omitempty"`
+}
+
+// readMemory reads count bytes at offset from an address or the value of
+// an expression. It gives the address that the bytes start at.
+func readMemory(mygdb Debugger, address string, offset int, count int) (uint64, []byte, []bool, error) {
+	result, err := mygdb.DataReadMemoryBytes(gdblib.DataReadMemoryBytesParms{Address: address, Offset: offset, Count: count})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	memory := miMemory{}
+	remarshal(result, &memory)
+	if len(memory.Memory) == 0 {
+		return 0, nil, nil, errors.New("Could not read the memory at " + address)
+	}
+
+	return placeMemory(memory.Memory, count)
+}
+
+// placeMemory lays out the blocks of memory that could be read over the
+// count bytes that were asked for. The bytes that couldn't be read,
+// before, between or after the blocks, are zero and not readable.
+func placeMemory(blocks []miMemoryBlock, count int) (uint64, []byte, []bool, error) {
+	contents := make([]byte, count)
+	readable := make([]bool, count)
+	var start uint64
+
+	for idx, block := range blocks {
+		begin, err := strconv.ParseUint(block.Begin, 0, 64)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		// Offsets are from the start of the range that was asked for
+		offset, err := strconv.ParseUint(block.Offset, 0, 64)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		bytes, err := hex.DecodeString(block.Contents)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+
+		if idx == 0 {
+			start = begin - offset
+		}
+
+		for i, b := range bytes {
+			if pos := offset + uint64(i); pos < uint64(count) {
+				contents[pos] = b
+				readable[pos] = true
+			}
+		}
+	}
+
+	return start, contents, readable, nil
+}
+
+func dumpMemory(begin uint64, contents []byte, readable []bool) []memoryLine {
+	lines := []memoryLine{}
+
+	for start := 0; start < len(contents); start += memoryLineSize {
+		end := start + memoryLineSize
+		if end > len(contents) {
+			end = len(contents)
+		}
+
+		line := memoryLine{Address: "0x" + strconv.FormatUint(begin+uint64(start), 16)}
+
+		bytes := []string{}
+		for idx := start; idx < end; idx++ {
+			b := contents[idx]
+
+			switch {
+			case !readable[idx]:
+				bytes = append(bytes, "??")
+				line.ASCII += " "
+			case b >= 0x20 && b < 0x7f:
+				bytes = append(bytes, hex.EncodeToString([]byte{b}))
+				line.ASCII += string(b)
+			default:
+				bytes = append(bytes, hex.EncodeToString([]byte{b}))
+				line.ASCII += "."
+			}
+		}
+		line.Hex = strings.Join(bytes, " ")
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// interpretMemory reads memory as a run of values of one type. Any bytes
+// left over at the end are ignored. Values with bytes that couldn't be
+// read are ??.
+func interpretMemory(contents []byte, readable []bool, memoryType string) []string {
+	size := memoryTypes[memoryType]
+	values := []string{}
+
+values:
+	for start := 0; start+size <= len(contents); start += size {
+		for _, ok := range readable[start : start+size] {
+			if !ok {
+				values = append(values, "??")
+				continue values
+			}
+		}
+
+		value := contents[start : start+size]
+		var bits uint64
+		for idx := size - 1; idx >= 0; idx-- {
+			bits = bits<<8 | uint64(value[idx])
+		}
+
+		switch memoryType {
+		case "int8":
+			values = append(values, strconv.FormatInt(int64(int8(bits)), 10))
+		case "int16":
+			values = append(values, strconv.FormatInt(int64(int16(bits)), 10))
+		case "int32":
+			values = append(values, strconv.FormatInt(int64(int32(bits)), 10))
+		case "int64":
+			values = append(values, strconv.FormatInt(int64(bits), 10))
+		case "float32":
+			values = append(values, strconv.FormatFloat(float64(math.Float32frombits(uint32(bits))), 'g', -1, 32))
+		case "float64":
+			values = append(values, strconv.FormatFloat(math.Float64frombits(bits), 'g', -1, 64))
+		case "pointer":
+			values = append(values, "0x"+strconv.FormatUint(bits, 16))
+		default:
+			values = append(values, strconv.FormatUint(bits, 10))
+		}
+	}
+
+	return values
+}
+
+func addMemoryHandlers(mygdb Debugger, readOnly bool) {
+	http.HandleFunc("/handle/memory/read", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			// An address or an expression whose value is one
+			Address string
+			// Bytes from the address to start at, negative to go back
+			Offset int
+			Count  int
+			// One of the memoryTypes to read the memory as
+			Type string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if parms.Count == 0 {
+			parms.Count = memoryPageSize
+		}
+
+		switch {
+		case err != nil:
+		case parms.Address == "":
+			err = errors.New("Expected an address")
+		case parms.Count < 0 || parms.Count > maxMemoryPageSize:
+			err = errors.New("Can only read up to " + strconv.Itoa(maxMemoryPageSize) + " bytes at a time")
+		case parms.Type != "" && memoryTypes[parms.Type] == 0:
+			err = errors.New("Unknown type: " + parms.Type)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		begin, contents, readable, err := readMemory(mygdb, parms.Address, parms.Offset, parms.Count)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		page := memoryPage{Address: "0x" + strconv.FormatUint(begin, 16), Offset: parms.Offset,
+			NextOffset: parms.Offset + parms.Count, Lines: dumpMemory(begin, contents, readable)}
+		if parms.Type != "" {
+			page.Values = interpretMemory(contents, readable, parms.Type)
+		}
+
+		resultBytes, err := json.Marshal(page)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	if readOnly {
+		return
+	}
+
+	http.HandleFunc("/handle/memory/write", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			Address string
+			// The bytes to write in hex, spaces between them are allowed
+			Contents string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		var contents []byte
+		if err == nil {
+			contents, err = hex.DecodeString(strings.Join(strings.Fields(parms.Contents), ""))
+		}
+
+		switch {
+		case err != nil:
+		case parms.Address == "":
+			err = errors.New("Expected an address")
+		case len(contents) == 0:
+			err = errors.New("Expected the bytes to write")
+		}
+
+		if err == nil {
+			err = mygdb.DataWriteMemoryBytes(gdblib.DataWriteMemoryBytesParms{Address: parms.Address,
+				Contents: hex.EncodeToString(contents)})
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+}
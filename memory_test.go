@@ -0,0 +1,142 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// allReadable marks n bytes as readable.
+func allReadable(n int) []bool {
+	readable := make([]bool, n)
+	for idx := range readable {
+		readable[idx] = true
+	}
+	return readable
+}
+
+var interpretMemoryTests = []struct {
+	contents   []byte
+	readable   []bool
+	memoryType string
+	values     []string
+}{
+	// Little endian
+	{[]byte{0x01, 0x02}, nil, "uint16", []string{"513"}},
+	{[]byte{0x01, 0x02, 0x03, 0x04}, nil, "uint32", []string{"67305985"}},
+	{[]byte{0x01, 0x02, 0x03, 0x04}, nil, "uint8", []string{"1", "2", "3", "4"}},
+	{[]byte{0xff, 0xff, 0xfe, 0xff}, nil, "int16", []string{"-1", "-2"}},
+	{[]byte{0x80}, nil, "int8", []string{"-128"}},
+	{[]byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, "int64", []string{"-2"}},
+	{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, nil, "uint64", []string{"18446744073709551615"}},
+	{[]byte{0x00, 0x00, 0x80, 0x3f}, nil, "float32", []string{"1"}},
+	{[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0xbf}, nil, "float64", []string{"-1.5"}},
+	{[]byte{0x00, 0x10, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00}, nil, "pointer", []string{"0x401000"}},
+	// Bytes left over at the end are ignored
+	{[]byte{0x01, 0x00, 0x02}, nil, "uint16", []string{"1"}},
+	{[]byte{0x01, 0x02, 0x03}, nil, "uint32", []string{}},
+	{[]byte{}, nil, "uint8", []string{}},
+	// Values with any byte that couldn't be read
+	{[]byte{0x01, 0x00, 0x00, 0x02, 0x03, 0x00}, []bool{true, true, false, true, true, true}, "uint16",
+		[]string{"1", "??", "3"}},
+	{[]byte{0x00, 0x01}, []bool{false, false}, "uint8", []string{"??", "??"}},
+}
+
+func TestInterpretMemory(t *testing.T) {
+	for _, tt := range interpretMemoryTests {
+		readable := tt.readable
+		if readable == nil {
+			readable = allReadable(len(tt.contents))
+		}
+
+		values := interpretMemory(tt.contents, readable, tt.memoryType)
+		if !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("interpretMemory(% x, %v, %s) = %q, want %q", tt.contents, readable, tt.memoryType, values, tt.values)
+		}
+	}
+}
+
+var dumpMemoryTests = []struct {
+	begin    uint64
+	contents []byte
+	readable []bool
+	lines    []memoryLine
+}{
+	{0x1000, []byte{}, nil, []memoryLine{}},
+	{0x1000, []byte("Hi!\x00\x7f\n"), nil, []memoryLine{{"0x1000", "48 69 21 00 7f 0a", "Hi!..."}}},
+	// Lines are split every memoryLineSize bytes, the last one can be short
+	{0x2000, []byte("0123456789abcdefgh"), nil, []memoryLine{
+		{"0x2000", "30 31 32 33 34 35 36 37 38 39 61 62 63 64 65 66", "0123456789abcdef"},
+		{"0x2010", "67 68", "gh"}}},
+	// Gaps at the start, in the middle and at the end
+	{0x3000, []byte{0, 0, 'a', 0, 'b', 0}, []bool{false, false, true, false, true, false}, []memoryLine{
+		{"0x3000", "?? ?? 61 ?? 62 ??", "  a b "}}},
+}
+
+func TestDumpMemory(t *testing.T) {
+	for _, tt := range dumpMemoryTests {
+		readable := tt.readable
+		if readable == nil {
+			readable = allReadable(len(tt.contents))
+		}
+
+		lines := dumpMemory(tt.begin, tt.contents, readable)
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("dumpMemory(%#x, % x, %v) = %v, want %v", tt.begin, tt.contents, readable, lines, tt.lines)
+		}
+	}
+}
+
+var placeMemoryTests = []struct {
+	blocks   []miMemoryBlock
+	count    int
+	start    uint64
+	contents []byte
+	readable []bool
+}{
+	{[]miMemoryBlock{{Begin: "0x1000", Offset: "0x0", End: "0x1004", Contents: "01020304"}}, 4,
+		0x1000, []byte{1, 2, 3, 4}, []bool{true, true, true, true}},
+	// The first readable byte is after the address that was asked for
+	{[]miMemoryBlock{{Begin: "0x1002", Offset: "0x2", End: "0x1004", Contents: "0304"}}, 4,
+		0x1000, []byte{0, 0, 3, 4}, []bool{false, false, true, true}},
+	// Memory runs out before the end
+	{[]miMemoryBlock{{Begin: "0x1000", Offset: "0x0", End: "0x1002", Contents: "0102"}}, 4,
+		0x1000, []byte{1, 2, 0, 0}, []bool{true, true, false, false}},
+	// A hole in the middle
+	{[]miMemoryBlock{{Begin: "0x1000", Offset: "0x0", End: "0x1001", Contents: "01"},
+		{Begin: "0x1003", Offset: "0x3", End: "0x1004", Contents: "04"}}, 4,
+		0x1000, []byte{1, 0, 0, 4}, []bool{true, false, false, true}},
+	// Anything past the range is dropped
+	{[]miMemoryBlock{{Begin: "0x1000", Offset: "0x0", End: "0x1003", Contents: "010203"}}, 2,
+		0x1000, []byte{1, 2}, []bool{true, true}},
+}
+
+func TestPlaceMemory(t *testing.T) {
+	for _, tt := range placeMemoryTests {
+		start, contents, readable, err := placeMemory(tt.blocks, tt.count)
+		if err != nil {
+			t.Errorf("placeMemory(%v, %d): %v", tt.blocks, tt.count, err)
+			continue
+		}
+
+		if start != tt.start || !reflect.DeepEqual(contents, tt.contents) || !reflect.DeepEqual(readable, tt.readable) {
+			t.Errorf("placeMemory(%v, %d) = %#x, % x, %v; want %#x, % x, %v", tt.blocks, tt.count,
+				start, contents, readable, tt.start, tt.contents, tt.readable)
+		}
+	}
+}
+
+func TestPlaceMemoryErrors(t *testing.T) {
+	for _, block := range []miMemoryBlock{
+		{Begin: "nowhere", Offset: "0x0", Contents: "00"},
+		{Begin: "0x1000", Offset: "", Contents: "00"},
+		{Begin: "0x1000", Offset: "0x0", Contents: "zz"},
+	} {
+		if _, _, _, err := placeMemory([]miMemoryBlock{block}, 1); err == nil {
+			t.Errorf("placeMemory(%v) succeeded, want an error", block)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+)
+
+// The following types mirror the JSON form of the gdblib results as seen
+// by the web UI. They let the server pick apart a result without caring
+// how gdblib happens to lay out its structs.
+
+type miFrame struct {
+	Level    string `json:"level"`
+	Addr     string `json:"addr"`
+	Func     string `json:"func"`
+	File     string `json:"file"`
+	Fullname string `json:"fullname"`
+	Line     string `json:"line"`
+}
+
+type miFrameInfo struct {
+	Frame miFrame `json:"frame"`
+}
+
+type miThread struct {
+	Id       string  `json:"id"`
+	TargetId string  `json:"target-id"`
+	Name     string  `json:"name"`
+	State    string  `json:"state"`
+	Frame    miFrame `json:"frame"`
+}
+
+type miThreads struct {
+	Threads         []miThread `json:"threads"`
+	CurrentThreadId string     `json:"current-thread-id"`
+}
+
+type miStack struct {
+	Stack []miFrame `json:"stack"`
+}
+
+type miVariable struct {
+	Name     string `json:"name"`
+	Exp      string `json:"expr"`
+	Value    string `json:"value"`
+	Type     string `json:"type"`
+	Numchild string `json:"numchild"`
+}
+
+type miVariables struct {
+	Variables []miVariable `json:"variables"`
+}
+
+type miChildren struct {
+	Numchild string       `json:"numchild"`
+	Children []miVariable `json:"children"`
+}
+
+type miVarChange struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// One of true, false or invalid
+	InScope string `json:"in_scope"`
+}
+
+type miVarUpdate struct {
+	Changelist []miVarChange `json:"changelist"`
+}
+
+type miVarFormat struct {
+	Format string `json:"format"`
+	Value  string `json:"value"`
+}
+
+type miVarType struct {
+	Type string `json:"type"`
+}
+
+type miStop struct {
+	Reason   string  `json:"reason"`
+	ThreadId string  `json:"thread-id"`
+	Frame    miFrame `json:"frame"`
+}
+
+type miBreakpoint struct {
+	Number   string `json:"number"`
+	Type     string `json:"type"`
+	Disp     string `json:"disp"`
+	Enabled  string `json:"enabled"`
+	Func     string `json:"func"`
+	File     string `json:"file"`
+	Fullname string `json:"fullname"`
+	Line     string `json:"line"`
+	What     string `json:"what,omitempty"`
+	Pending  string `json:"pending,omitempty"`
+	Cond     string `json:"cond,omitempty"`
+	Ignore   string `json:"ignore,omitempty"`
+	Times    string `json:"times"`
+	// The location as it was given when the breakpoint was set
+	OriginalLocation string `json:"original-location,omitempty"`
+	// Set for catchpoints, syscall or signal for example
+	CatchType string `json:"catch-type,omitempty"`
+}
+
+type miBreakInsert struct {
+	Bkpt miBreakpoint `json:"bkpt"`
+}
+
+// Watchpoints are reported under a key that depends on their kind
+type miWatchpoint struct {
+	Number string `json:"number"`
+	Exp    string `json:"exp"`
+}
+
+type miBreakWatch struct {
+	Wpt    *miWatchpoint `json:"wpt"`
+	HwRwpt *miWatchpoint `json:"hw-rwpt"`
+	HwAwpt *miWatchpoint `json:"hw-awpt"`
+}
+
+func (m miBreakWatch) watchpoint() *miWatchpoint {
+	switch {
+	case m.Wpt != nil:
+		return m.Wpt
+	case m.HwRwpt != nil:
+		return m.HwRwpt
+	}
+	return m.HwAwpt
+}
+
+type miBreakList struct {
+	BreakPointTable struct {
+		Body []miBreakpoint `json:"body"`
+	}
+}
+
+type miInstruction struct {
+	Address  string `json:"address"`
+	FuncName string `json:"func-name"`
+	Offset   string `json:"offset"`
+	Inst     string `json:"inst"`
+	// Only given when asked for
+	Opcodes string `json:"opcodes,omitempty"`
+}
+
+// miSourceLine is one line of source along with the instructions that it
+// compiled to, as given by the disassembly modes that include source.
+type miSourceLine struct {
+	Line         string          `json:"line"`
+	File         string          `json:"file"`
+	Fullname     string          `json:"fullname"`
+	Instructions []miInstruction `json:"line_asm_insn"`
+}
+
+// Registers are given by number, names have gaps for the numbers that
+// aren't in use.
+type miRegisterNames struct {
+	Names []string `json:"register-names"`
+}
+
+type miRegisterValue struct {
+	Number string `json:"number"`
+	Value  string `json:"value"`
+}
+
+type miRegisterValues struct {
+	Values []miRegisterValue `json:"register-values"`
+}
+
+type miChangedRegisters struct {
+	Changed []string `json:"changed-registers"`
+}
+
+// Memory that can't all be read comes back in several blocks
+type miMemoryBlock struct {
+	Begin    string `json:"begin"`
+	Offset   string `json:"offset"`
+	End      string `json:"end"`
+	Contents string `json:"contents"`
+}
+
+type miMemory struct {
+	Memory []miMemoryBlock `json:"memory"`
+}
+
+// remarshal copies a gdblib result into one of the mi types above by way
+// of its JSON encoding.
+func remarshal(in interface{}, out interface{}) error {
+	bytes, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bytes, out)
+}
@@ -0,0 +1,124 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/sirnewton01/godbg/gdblib"
+	"os"
+	"strings"
+)
+
+// panicFunctions are the runtime functions that a Go program goes
+// through when it panics or dies, along with the argument that holds
+// the panic value in each of them.
+var panicFunctions = []struct {
+	function string
+	value    string
+}{
+	{"runtime.gopanic", "e"},
+	{"runtime.fatalpanic", "msgs.arg"},
+	{"runtime.throw", "s"},
+}
+
+// panicEvent is sent to the web clients when the program stops because
+// it panicked. Frame is the frame that caused the panic, the first one
+// on the stack outside of the runtime.
+type panicEvent struct {
+	Function string
+	Value    string
+	ThreadId string
+	Stack    []miFrame
+	Frame    miFrame
+}
+
+// catchPanics stops the program whenever it panics or hits a fatal
+// runtime error, rather than letting it print a trace and exit, so that
+// the faulting frame can be examined.
+func (s *session) catchPanics() {
+	for _, fn := range panicFunctions {
+		result, err := s.mygdb.BreakInsert(gdblib.BreakInsertParms{Location: fn.function})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not break on %v: %v\n", fn.function, err)
+			continue
+		}
+
+		inserted := miBreakInsert{}
+		remarshal(result, &inserted)
+
+		s.mutex.Lock()
+		s.panics[inserted.Bkpt.Number] = fn.function
+		s.mutex.Unlock()
+	}
+}
+
+// panicFunction reports which runtime function a panic breakpoint is on.
+func (s *session) panicFunction(number string) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	function, ok := s.panics[number]
+	return function, ok
+}
+
+// panicStop reports the runtime function, if any, that a stop record
+// shows the program to have panicked in.
+func (s *session) panicStop(record gdblib.AsyncResultRecord) (string, bool) {
+	if record.Indication != "stopped" {
+		return "", false
+	}
+
+	reason, _ := record.Result["reason"].(string)
+	number, _ := record.Result["bkptno"].(string)
+	if reason != "breakpoint-hit" {
+		return "", false
+	}
+
+	return s.panicFunction(number)
+}
+
+// panicHit tells the clients about a panic once the program has stopped
+// in one of the panic functions. This happens away from the pump since
+// gdb may need to deliver more records before it answers.
+func (s *session) panicHit(function string, record gdblib.AsyncResultRecord) {
+	stop := miStop{}
+	remarshal(record.Result, &stop)
+
+	event := panicEvent{Function: function, ThreadId: stop.ThreadId, Frame: stop.Frame}
+
+	for _, fn := range panicFunctions {
+		if fn.function != function {
+			continue
+		}
+
+		result, err := s.mygdb.VarCreate(gdblib.VarCreateParms{Expression: fn.value})
+		if err != nil {
+			event.Value = "<" + err.Error() + ">"
+			break
+		}
+
+		value := miVariable{}
+		remarshal(result, &value)
+		s.mygdb.VarDelete(gdblib.VarDeleteParms{Name: value.Name})
+
+		event.Value = value.Value
+	}
+
+	result, err := s.mygdb.StackListFrames(gdblib.StackListFramesParms{ThreadId: stop.ThreadId})
+	if err == nil {
+		stack := miStack{}
+		remarshal(result, &stack)
+		event.Stack = stack.Stack
+
+		for _, frame := range stack.Stack {
+			if !strings.HasPrefix(frame.Func, "runtime.") {
+				event.Frame = frame
+				break
+			}
+		}
+	}
+
+	s.hub.publish(webSockResult{Type: "panic", Data: event})
+}
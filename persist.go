@@ -0,0 +1,304 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirnewton01/godbg/gdblib"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// savedState is the part of a debug session that outlives it. It is kept
+// in .godbg/session.json in the project's source directory and can also
+// be exported to share with others.
+type savedState struct {
+	Breakpoints []savedBreakpoint
+	Expressions []string
+}
+
+type savedBreakpoint struct {
+	Location    string
+	Condition   string `json:",omitempty"`
+	Enabled     bool
+	IgnoreCount int `json:",omitempty"`
+	// Message of a logpoint
+	Format string `json:",omitempty"`
+}
+
+// stateFile is where the saved state of the project in a source
+// directory is kept.
+func stateFile(srcDir string) string {
+	if srcDir == "" {
+		srcDir = cwd
+	}
+	return filepath.Join(srcDir, ".godbg", "session.json")
+}
+
+// breakpointLocation finds a location that will still find a breakpoint
+// once the program has been rebuilt.
+func breakpointLocation(bp miBreakpoint) string {
+	switch {
+	case bp.OriginalLocation != "":
+		return bp.OriginalLocation
+	case bp.Pending != "":
+		return bp.Pending
+	case bp.Fullname != "" && bp.Line != "":
+		return bp.Fullname + ":" + bp.Line
+	}
+	return bp.Func
+}
+
+// savedState captures the breakpoints and watch expressions of the
+// session. Temporary breakpoints go away on their own and watchpoints
+// refer to the memory of this particular run so neither is kept. The
+// panic breakpoints are set at startup anyway.
+func (s *session) savedState() (*savedState, error) {
+	breakpoints, err := listBreakpoints(s.mygdb, s.logpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &savedState{Breakpoints: []savedBreakpoint{}, Expressions: s.watchExpressions()}
+
+	for _, bp := range breakpoints.BreakPointTable.Body {
+		if (bp.Type != "breakpoint" && bp.Type != "logpoint") || bp.Disp == "del" {
+			continue
+		}
+		if _, ok := s.panicFunction(bp.Number); ok {
+			continue
+		}
+
+		saved := savedBreakpoint{Location: breakpointLocation(bp), Condition: bp.Cond, Enabled: bp.Enabled == "y"}
+		saved.IgnoreCount, _ = strconv.Atoi(bp.Ignore)
+		if bp.Type == "logpoint" {
+			saved.Format = bp.What
+		}
+
+		state.Breakpoints = append(state.Breakpoints, saved)
+	}
+
+	return state, nil
+}
+
+// applyState adds the breakpoints and watch expressions of a saved state
+// to the session. Breakpoints that can't be set are reported and skipped.
+func (s *session) applyState(state *savedState) []string {
+	problems := []string{}
+
+	for _, saved := range state.Breakpoints {
+		result, err := s.mygdb.BreakInsert(gdblib.BreakInsertParms{Location: saved.Location,
+			Condition: saved.Condition, IgnoreCount: saved.IgnoreCount, Pending: true})
+		if err != nil {
+			problems = append(problems, saved.Location+": "+err.Error())
+			continue
+		}
+
+		inserted := miBreakInsert{}
+		remarshal(result, &inserted)
+
+		if saved.Format != "" {
+			err = s.logpoints.add(inserted.Bkpt.Number, saved.Format)
+		}
+		if err == nil && !saved.Enabled {
+			err = s.mygdb.BreakDisable(gdblib.BreakDisableParms{Breakpoints: []string{inserted.Bkpt.Number}})
+		}
+		if err != nil {
+			problems = append(problems, saved.Location+": "+err.Error())
+		}
+	}
+
+	for _, expression := range state.Expressions {
+		s.addWatchExpression(expression)
+	}
+
+	return problems
+}
+
+// restore applies the state saved in a file, if there is one, and keeps
+// saving to the file from now on.
+func (s *session) restore(path string) {
+	s.mutex.Lock()
+	s.statePath = path
+	s.mutex.Unlock()
+
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+
+	state := &savedState{}
+	if err == nil {
+		err = json.Unmarshal(bytes, state)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not restore the session from %v: %v\n", path, err)
+		return
+	}
+
+	for _, problem := range s.applyState(state) {
+		fmt.Fprintf(os.Stderr, "Could not restore breakpoint %v\n", problem)
+	}
+}
+
+// save writes the session's state to its file after a change.
+func (s *session) save() {
+	s.mutex.Lock()
+	path := s.statePath
+	s.mutex.Unlock()
+
+	if path == "" {
+		return
+	}
+
+	state, err := s.savedState()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+
+	var bytes []byte
+	if err == nil {
+		bytes, err = json.MarshalIndent(state, "", "\t")
+	}
+	if err == nil {
+		err = ioutil.WriteFile(path, bytes, 0644)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not save the session to %v: %v\n", path, err)
+	}
+}
+
+func (s *session) watchExpressions() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string{}, s.expressions...)
+}
+
+func (s *session) addWatchExpression(expression string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, existing := range s.expressions {
+		if existing == expression {
+			return
+		}
+	}
+	s.expressions = append(s.expressions, expression)
+}
+
+func (s *session) removeWatchExpression(expression string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for idx, existing := range s.expressions {
+		if existing == expression {
+			s.expressions = append(s.expressions[:idx], s.expressions[idx+1:]...)
+			return
+		}
+	}
+}
+
+func addPersistenceHandlers(mysession *session) {
+	http.HandleFunc("/handle/expression/list", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resultBytes, err := json.Marshal(map[string]interface{}{"Expressions": mysession.watchExpressions()})
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	http.HandleFunc("/handle/expression/add", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct{ Expression string }{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil || parms.Expression == "" {
+			w.WriteHeader(400)
+			w.Write([]byte("Expected an expression"))
+			return
+		}
+
+		mysession.addWatchExpression(parms.Expression)
+		mysession.save()
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/expression/remove", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct{ Expression string }{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		mysession.removeWatchExpression(parms.Expression)
+		mysession.save()
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/session/export", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, err := mysession.savedState()
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.MarshalIndent(state, "", "\t")
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Disposition", "attachment; filename=\"session.json\"")
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	http.HandleFunc("/handle/session/import", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := &savedState{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(state)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		// Imported breakpoints are added to the ones already set
+		problems := mysession.applyState(state)
+		mysession.save()
+
+		resultBytes, err := json.Marshal(map[string]interface{}{"Problems": problems})
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+}
@@ -0,0 +1,138 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// attacher is implemented by the backends that can attach to, and later
+// detach from, an already running process.
+type attacher interface {
+	Attach(pid int) error
+	Detach() error
+}
+
+type processInfo struct {
+	Pid     int
+	Cmdline string
+	Exe     string
+	// Go binaries also report their toolchain version and main package
+	Go        bool
+	GoVersion string
+	Path      string
+	Self      bool
+}
+
+// processExecutable finds the executable that a process is running.
+func processExecutable(pid int) (string, error) {
+	exe, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", errors.New("Could not determine the executable of process " + strconv.Itoa(pid) + ", please provide it after the process id")
+	}
+	return exe, nil
+}
+
+// listProcesses scans /proc for the processes that the user can see.
+func listProcesses() ([]processInfo, error) {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	processes := []processInfo{}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		process := processInfo{Pid: pid, Self: pid == os.Getpid()}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			// Kernel threads and processes that have gone away
+			continue
+		}
+		process.Cmdline = strings.TrimSpace(string(bytes.Replace(cmdline, []byte{0}, []byte{' '}, -1)))
+
+		// The executable is only readable for our own processes
+		process.Exe, err = processExecutable(pid)
+		if err == nil {
+			info, err := buildinfo.ReadFile(process.Exe)
+			if err == nil {
+				process.Go = true
+				process.GoVersion = info.GoVersion
+				process.Path = info.Path
+			}
+		}
+
+		processes = append(processes, process)
+	}
+
+	sort.Slice(processes, func(i, j int) bool { return processes[i].Pid < processes[j].Pid })
+	return processes, nil
+}
+
+func addProcessHandlers(myattacher attacher) {
+	http.HandleFunc("/handle/process/list", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := listProcesses()
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(result)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	http.HandleFunc("/handle/process/attach", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct{ Pid int }{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil {
+			err = myattacher.Attach(parms.Pid)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+
+	http.HandleFunc("/handle/process/detach", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := myattacher.Detach()
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+}
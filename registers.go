@@ -0,0 +1,214 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// registerWriter is implemented by the backends that can change the
+// registers of the stopped program.
+type registerWriter interface {
+	SetRegister(name string, value string) error
+}
+
+var registerNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.]*$`)
+
+type register struct {
+	Number string
+	Name   string
+	Value  string
+	// Changed since the program last stopped
+	Changed bool
+}
+
+// registerSummary picks out the registers that matter most to Go code.
+// Go keeps the current goroutine's g in a register on the architectures
+// with a register based calling convention.
+type registerSummary struct {
+	Arch           string
+	Goroutine      *register `json:",omitempty"`
+	StackPointer   *register
+	ProgramCounter *register
+}
+
+// goRegisters tells the architectures apart by their register names.
+var goRegisters = []struct {
+	arch      string
+	goroutine string
+	stack     string
+	pc        string
+}{
+	{"amd64", "r14", "rsp", "rip"},
+	{"arm64", "x28", "sp", "pc"},
+	{"386", "", "esp", "eip"},
+}
+
+// Formats of -data-list-register-values
+var registerFormats = map[string]bool{"x": true, "o": true, "t": true, "d": true, "r": true, "N": true}
+
+// listRegisters puts together the names, values and changes of the
+// registers in the selected frame.
+func listRegisters(mygdb Debugger, format string) ([]register, error) {
+	result, err := mygdb.DataListRegisterNames()
+	if err != nil {
+		return nil, err
+	}
+	names := miRegisterNames{}
+	remarshal(result, &names)
+
+	result, err = mygdb.DataListRegisterValues(gdblib.DataListRegisterValuesParms{Format: format})
+	if err != nil {
+		return nil, err
+	}
+	values := miRegisterValues{}
+	remarshal(result, &values)
+
+	result, err = mygdb.DataListChangedRegisters()
+	if err != nil {
+		return nil, err
+	}
+	changes := miChangedRegisters{}
+	remarshal(result, &changes)
+
+	changed := make(map[string]bool)
+	for _, number := range changes.Changed {
+		changed[number] = true
+	}
+
+	registers := []register{}
+	for _, value := range values.Values {
+		n, err := strconv.Atoi(value.Number)
+		if err != nil || n >= len(names.Names) || names.Names[n] == "" {
+			continue
+		}
+
+		registers = append(registers, register{Number: value.Number, Name: names.Names[n],
+			Value: value.Value, Changed: changed[value.Number]})
+	}
+
+	return registers, nil
+}
+
+func summarizeRegisters(registers []register) *registerSummary {
+	byName := make(map[string]*register)
+	for idx := range registers {
+		byName[registers[idx].Name] = &registers[idx]
+	}
+
+	for _, arch := range goRegisters {
+		if byName[arch.pc] == nil || byName[arch.stack] == nil {
+			continue
+		}
+		if arch.goroutine != "" && byName[arch.goroutine] == nil {
+			continue
+		}
+
+		return &registerSummary{Arch: arch.arch, Goroutine: byName[arch.goroutine],
+			StackPointer: byName[arch.stack], ProgramCounter: byName[arch.pc]}
+	}
+	return nil
+}
+
+func (d gdbDebugger) SetRegister(name string, value string) error {
+	return d.console("set var $" + name + " = " + value)
+}
+
+func addRegisterHandlers(mygdb Debugger, readOnly bool) {
+	writeRegisters := func(w http.ResponseWriter, format string) {
+		registers, err := listRegisters(mygdb, format)
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(map[string]interface{}{"Registers": registers,
+			"Summary": summarizeRegisters(registers)})
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}
+
+	http.HandleFunc("/handle/registers", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			// One of x, o, t, d, r or N (natural), hex by default
+			Format string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil && parms.Format != "" && !registerFormats[parms.Format] {
+			err = errors.New("Unknown register format: " + parms.Format)
+		}
+
+		if err != nil && err != io.EOF {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		if parms.Format == "" {
+			parms.Format = "x"
+		}
+
+		writeRegisters(w, parms.Format)
+	}))
+
+	mywriter, ok := mygdb.(registerWriter)
+	if !ok || readOnly {
+		return
+	}
+
+	http.HandleFunc("/handle/registers/set", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			Name  string
+			Value string
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		// The value goes to gdb's command line so it has to be a number
+		name := strings.TrimPrefix(parms.Name, "$")
+		if err == nil && !registerNamePattern.MatchString(name) {
+			err = errors.New("Invalid register name: " + parms.Name)
+		}
+		if err == nil {
+			_, intErr := strconv.ParseInt(parms.Value, 0, 64)
+			_, uintErr := strconv.ParseUint(parms.Value, 0, 64)
+			_, floatErr := strconv.ParseFloat(parms.Value, 64)
+			if intErr != nil && uintErr != nil && floatErr != nil {
+				err = errors.New("Expected a number for the register value: " + parms.Value)
+			}
+		}
+
+		if err == nil {
+			err = mywriter.SetRegister(name, parms.Value)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		writeRegisters(w, "x")
+	}))
+}
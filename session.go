@@ -0,0 +1,302 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sirnewton01/godbg/gdblib"
+	"golang.org/x/net/websocket"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of recent events kept for clients that reconnect
+	eventHistorySize = 1024
+	// Interval between heartbeats sent to idle clients
+	heartbeatInterval = 30 * time.Second
+)
+
+type webSockResult struct {
+	Seq  uint64
+	Type string
+	Data interface{}
+}
+
+// session owns the gdb event stream independently of any browser
+// connection so that clients can come and go without ending the
+// debug session.
+type session struct {
+	mygdb       Debugger
+	idleTimeout time.Duration
+	// Read-only sessions such as core dumps reject execution control
+	readOnly bool
+
+	hub       *broadcaster
+	logpoints *logpointTable
+	varobjs   *varobjRegistry
+	// Signal catchpoints are only told of on the console just before the
+	//  stop, this is that line until the next record. Only the pump uses it.
+	catchLine string
+
+	mutex     sync.Mutex
+	clients   int
+	state     string
+	idleTimer *time.Timer
+
+	// Where the breakpoints and watch expressions are saved, if anywhere
+	statePath   string
+	expressions []string
+
+	// Breakpoints on the runtime's panic functions by number
+	panics map[string]string
+
+	signals *signalTable
+}
+
+func newSession(mygdb Debugger, idleTimeout time.Duration, readOnly bool) *session {
+	s := &session{mygdb: mygdb, idleTimeout: idleTimeout, readOnly: readOnly, state: "running",
+		panics: make(map[string]string), signals: newSignalTable()}
+	if readOnly {
+		s.state = "stopped"
+	}
+	s.hub = newBroadcaster(eventHistorySize)
+	s.logpoints = newLogpointTable()
+	s.varobjs = newVarobjRegistry(mygdb, s.hub)
+
+	// Nobody is connected yet so the idle clock starts now
+	s.mutex.Lock()
+	s.startIdleTimer()
+	s.mutex.Unlock()
+
+	go s.pump()
+
+	return s
+}
+
+// pump consumes the gdb channels once for the lifetime of the session
+// and fans each event out to every connected client.
+func (s *session) pump() {
+	for {
+		select {
+		case data := <-s.mygdb.ConsoleLines():
+			if signalCatchPattern.MatchString(data) {
+				s.catchLine = data
+			}
+			s.hub.publish(webSockResult{Type: "console", Data: data})
+		case data := <-s.mygdb.TargetLines():
+			s.hub.publish(webSockResult{Type: "target", Data: data})
+		case data := <-s.mygdb.LogLines():
+			s.hub.publish(webSockResult{Type: "gdb", Data: data})
+		case record := <-s.mygdb.AsyncRecords():
+			catchLine := s.catchLine
+			s.catchLine = ""
+
+			if number, ok := s.logpoints.stoppedAt(record); ok {
+				// Clients never see the program stop at a logpoint
+				go s.logpointHit(number, record)
+				continue
+			}
+
+			s.trackState(record)
+			addProgramCounter(record)
+			s.hub.publish(webSockResult{Type: "async", Data: record})
+			s.varobjs.stopped(record)
+
+			if event, ok := watchpointTrigger(record); ok {
+				s.hub.publish(webSockResult{Type: "watchpoint-trigger", Data: event})
+			}
+			if event, ok := catchStop(record, catchLine); ok {
+				s.hub.publish(webSockResult{Type: "catch", Data: event})
+			}
+			if function, ok := s.panicStop(record); ok {
+				go s.panicHit(function, record)
+			}
+		}
+	}
+}
+
+// logpointHit logs the message of a logpoint and resumes the program.
+// This happens away from the pump since gdb may need to deliver more
+// records before it answers.
+func (s *session) logpointHit(number string, record gdblib.AsyncResultRecord) {
+	parts, hits, ok := s.logpoints.hit(number)
+	if ok {
+		stop := miStop{}
+		remarshal(record.Result, &stop)
+
+		event := logpointEvent{Number: number, Message: renderLogMessage(s.mygdb, parts),
+			Hits: hits, ThreadId: stop.ThreadId, Frame: stop.Frame}
+		s.hub.publish(webSockResult{Type: "logpoint", Data: event})
+	}
+
+	err := s.mygdb.ExecContinue(gdblib.ExecContinueParms{})
+	if err != nil {
+		s.hub.publish(webSockResult{Type: "gdb", Data: "Could not continue after logpoint " + number + ": " + err.Error() + "\n"})
+	}
+}
+
+func (s *session) trackState(record gdblib.AsyncResultRecord) {
+	if record.Indication != "stopped" && record.Indication != "running" {
+		return
+	}
+
+	s.mutex.Lock()
+	s.state = record.Indication
+	s.mutex.Unlock()
+}
+
+func (s *session) runState() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.state
+}
+
+func (s *session) connect() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.clients++
+	if s.idleTimer != nil {
+		s.idleTimer.Stop()
+		s.idleTimer = nil
+	}
+}
+
+func (s *session) disconnect() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.clients--
+	if s.clients == 0 {
+		s.startIdleTimer()
+	}
+}
+
+// startIdleTimer must be called with the mutex held.
+func (s *session) startIdleTimer() {
+	if s.idleTimeout <= 0 {
+		return
+	}
+
+	s.idleTimer = time.AfterFunc(s.idleTimeout, func() {
+		fmt.Fprintf(os.Stderr, "No client connected for %v, exiting\n", s.idleTimeout)
+		s.mygdb.Exit()
+	})
+}
+
+// serve streams session events to a single websocket client until
+// it goes away or falls behind. A client reconnecting with a "since"
+// query parameter is replayed the events it missed if they are still
+// available, otherwise it is told to resync its view of the session.
+func (s *session) serve(ws *websocket.Conn) {
+	s.connect()
+	defer s.disconnect()
+
+	since, _ := strconv.ParseUint(ws.Request().URL.Query().Get("since"), 10, 64)
+
+	sub, seq, replayed := s.hub.subscribe(since)
+	defer s.hub.unsubscribe(sub)
+
+	// The client never sends anything so a failed read means it is gone
+	closed := make(chan bool)
+	go func() {
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		close(closed)
+	}()
+
+	var err error
+	if !replayed {
+		err = writeEvent(ws, webSockResult{Type: "resync",
+			Data: map[string]interface{}{"State": s.runState(), "Seq": seq, "ReadOnly": s.readOnly}})
+	}
+
+	for err == nil {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				// Dropped by the broadcaster for being too slow
+				ws.Close()
+				err = io.ErrShortWrite
+			} else {
+				err = writeEvent(ws, event)
+			}
+		case <-time.After(heartbeatInterval):
+			err = writeEvent(ws, webSockResult{Type: "heartbeat", Data: ""})
+		case <-closed:
+			err = io.EOF
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Client disconnect\n")
+}
+
+func writeEvent(ws *websocket.Conn, event webSockResult) error {
+	bytes, err := json.Marshal(&event)
+	if err != nil {
+		// TODO log the marshalling error
+		return nil
+	}
+
+	_, err = ws.Write(bytes)
+	return err
+}
+
+func addSessionHandlers(mysession *session) {
+	http.HandleFunc("/handle/session/state", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type sessionState struct {
+			Seq         uint64
+			State       string
+			ReadOnly    bool
+			Threads     interface{}
+			Frame       interface{}
+			Breakpoints interface{}
+		}
+
+		// Events after this sequence number may or may not be reflected
+		//  in the state so the client should apply them on top of it.
+		result := sessionState{Seq: mysession.hub.lastSeq(), State: mysession.runState(), ReadOnly: mysession.readOnly}
+
+		threads, err := mysession.mygdb.ThreadInfo(gdblib.ThreadInfoParms{})
+		if err == nil {
+			result.Threads = threads
+		}
+
+		if result.State == "stopped" {
+			frame, err := mysession.mygdb.StackInfoFrame()
+			if err == nil {
+				result.Frame = frame
+			}
+		}
+
+		breakpoints, err := listBreakpoints(mysession.mygdb, mysession.logpoints)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		result.Breakpoints = breakpoints
+
+		resultBytes, err := json.Marshal(result)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+}
@@ -0,0 +1,253 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// signalHandler is implemented by the backends that intercept the
+// signals sent to the program.
+type signalHandler interface {
+	HandleSignal(setting signalSetting) error
+	// SendSignal resumes the stopped program with a signal. It is up to
+	//  the caller to make sure that the program is stopped.
+	SendSignal(signal string) error
+}
+
+// signalSetting says what happens when the program receives a signal:
+// whether it stops, whether the debugger mentions it and whether the
+// program gets to see it.
+type signalSetting struct {
+	Signal string
+	Stop   bool
+	Print  bool
+	Pass   bool
+}
+
+// Go programs receive these all the time, SIGURG for goroutine preemption
+// and SIGPROF when profiling, and handle them themselves.
+const goSignalDefaults = "SIGURG=nostop,noprint SIGPROF=nostop,noprint SIGPIPE=nostop,print"
+
+var signalNamePattern = regexp.MustCompile(`^SIG[A-Z0-9]+$`)
+
+// signalTable keeps track of the signal settings since gdb only reports
+// them as console output.
+type signalTable struct {
+	mutex    sync.Mutex
+	settings []signalSetting
+}
+
+// newSignalTable starts with gdb's own settings for the common signals.
+func newSignalTable() *signalTable {
+	t := &signalTable{}
+
+	for _, signal := range []string{"SIGHUP", "SIGINT", "SIGQUIT", "SIGILL", "SIGTRAP", "SIGABRT",
+		"SIGBUS", "SIGFPE", "SIGKILL", "SIGUSR1", "SIGSEGV", "SIGUSR2", "SIGPIPE", "SIGALRM",
+		"SIGTERM", "SIGCHLD", "SIGCONT", "SIGSTOP", "SIGTSTP", "SIGTTIN", "SIGTTOU", "SIGURG",
+		"SIGXCPU", "SIGXFSZ", "SIGVTALRM", "SIGPROF", "SIGWINCH", "SIGIO", "SIGPWR", "SIGSYS"} {
+		setting := signalSetting{Signal: signal, Stop: true, Print: true, Pass: true}
+
+		switch signal {
+		case "SIGINT", "SIGTRAP":
+			// These belong to the debugger
+			setting.Pass = false
+		case "SIGALRM", "SIGURG", "SIGCHLD", "SIGWINCH", "SIGIO", "SIGVTALRM", "SIGPROF":
+			setting.Stop = false
+			setting.Print = false
+		}
+
+		t.settings = append(t.settings, setting)
+	}
+
+	return t
+}
+
+func (t *signalTable) list() []signalSetting {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return append([]signalSetting{}, t.settings...)
+}
+
+func (t *signalTable) lookup(signal string) (signalSetting, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, setting := range t.settings {
+		if setting.Signal == signal {
+			return setting, true
+		}
+	}
+	return signalSetting{Signal: signal, Stop: true, Print: true, Pass: true}, false
+}
+
+// set changes the setting of a signal. The program can't stop for a
+// signal without it being mentioned.
+func (t *signalTable) set(handler signalHandler, setting signalSetting) error {
+	if !signalNamePattern.MatchString(setting.Signal) {
+		return errors.New("Invalid signal name: " + setting.Signal)
+	}
+
+	setting.Print = setting.Print || setting.Stop
+
+	err := handler.HandleSignal(setting)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for idx := range t.settings {
+		if t.settings[idx].Signal == setting.Signal {
+			t.settings[idx] = setting
+			return nil
+		}
+	}
+	t.settings = append(t.settings, setting)
+	return nil
+}
+
+// configure applies settings given as a list such as
+// "SIGPIPE=stop SIGUSR1=nopass" on top of the current ones. The actions
+// mean the same as they do for gdb's handle command.
+func (t *signalTable) configure(handler signalHandler, spec string) error {
+	for _, entry := range strings.Fields(spec) {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("Expected SIGNAL=actions in " + entry)
+		}
+
+		setting, _ := t.lookup(parts[0])
+
+		for _, action := range strings.Split(parts[1], ",") {
+			switch action {
+			case "stop":
+				setting.Stop = true
+				setting.Print = true
+			case "nostop":
+				setting.Stop = false
+			case "print":
+				setting.Print = true
+			case "noprint":
+				setting.Print = false
+				setting.Stop = false
+			case "pass":
+				setting.Pass = true
+			case "nopass":
+				setting.Pass = false
+			default:
+				return errors.New("Unknown signal action " + action + " in " + entry)
+			}
+		}
+
+		err := t.set(handler, setting)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d gdbDebugger) HandleSignal(setting signalSetting) error {
+	command := "handle " + setting.Signal
+	for _, action := range []struct {
+		on      bool
+		yes, no string
+	}{{setting.Stop, "stop", "nostop"}, {setting.Print, "print", "noprint"}, {setting.Pass, "pass", "nopass"}} {
+		if action.on {
+			command += " " + action.yes
+		} else {
+			command += " " + action.no
+		}
+	}
+
+	return d.console(command)
+}
+
+func (d gdbDebugger) SendSignal(signal string) error {
+	if !signalNamePattern.MatchString(signal) {
+		return errors.New("Invalid signal name: " + signal)
+	}
+
+	return d.console("signal " + signal)
+}
+
+func addSignalHandlers(myhandler signalHandler, mysession *session) {
+	mysignals := mysession.signals
+
+	http.HandleFunc("/handle/signals", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct {
+			// New settings for some signals, the list is only returned if empty
+			Changes []signalSetting
+		}{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err != nil && err != io.EOF {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		for _, setting := range parms.Changes {
+			err = mysignals.set(myhandler, setting)
+
+			if err != nil {
+				w.WriteHeader(400)
+				w.Write([]byte(err.Error()))
+				return
+			}
+		}
+
+		resultBytes, err := json.Marshal(mysignals.list())
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+
+	if mysession.readOnly {
+		return
+	}
+
+	// Sending a signal resumes the program so it is refused with a 409
+	//  while the program is running rather than interrupting it first.
+	http.HandleFunc("/handle/exec/signal", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parms := struct{ Signal string }{}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&parms)
+
+		if err == nil && mysession.runState() != "stopped" {
+			w.WriteHeader(409)
+			w.Write([]byte("The program must be stopped to resume it with a signal"))
+			return
+		}
+
+		if err == nil {
+			err = myhandler.SendSignal(parms.Signal)
+		}
+
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(200)
+	}))
+}
@@ -0,0 +1,96 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recordingHandler remembers the settings that it is asked to apply.
+type recordingHandler struct {
+	handled []signalSetting
+}
+
+func (h *recordingHandler) HandleSignal(setting signalSetting) error {
+	h.handled = append(h.handled, setting)
+	return nil
+}
+
+func (h *recordingHandler) SendSignal(signal string) error {
+	return nil
+}
+
+var configureTests = []struct {
+	spec string
+	want []signalSetting
+}{
+	{"", nil},
+	{"SIGPIPE=stop", []signalSetting{{"SIGPIPE", true, true, true}}},
+	{"SIGUSR1=nostop", []signalSetting{{"SIGUSR1", false, true, true}}},
+	{"SIGUSR1=nostop,noprint", []signalSetting{{"SIGUSR1", false, false, true}}},
+	// Not mentioning a signal means not stopping for it either
+	{"SIGUSR1=noprint", []signalSetting{{"SIGUSR1", false, false, true}}},
+	{"SIGALRM=stop,noprint", []signalSetting{{"SIGALRM", false, false, true}}},
+	// Stopping means mentioning it
+	{"SIGALRM=noprint,stop", []signalSetting{{"SIGALRM", true, true, true}}},
+	{"SIGALRM=print", []signalSetting{{"SIGALRM", false, true, true}}},
+	{"SIGINT=pass", []signalSetting{{"SIGINT", true, true, true}}},
+	{"SIGUSR2=nopass", []signalSetting{{"SIGUSR2", true, true, false}}},
+	// Signals that aren't in the table start from gdb's defaults
+	{"SIG34=nostop", []signalSetting{{"SIG34", false, true, true}}},
+	// Later entries build on earlier ones
+	{"SIGUSR1=nostop SIGUSR1=nopass", []signalSetting{{"SIGUSR1", false, true, true}, {"SIGUSR1", false, true, false}}},
+	{goSignalDefaults, []signalSetting{{"SIGURG", false, false, true}, {"SIGPROF", false, false, true},
+		{"SIGPIPE", false, true, true}}},
+}
+
+func TestConfigure(t *testing.T) {
+	for _, tt := range configureTests {
+		table := newSignalTable()
+		handler := &recordingHandler{}
+
+		err := table.configure(handler, tt.spec)
+		if err != nil {
+			t.Errorf("configure(%q): %v", tt.spec, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(handler.handled, tt.want) {
+			t.Errorf("configure(%q) handled %v, want %v", tt.spec, handler.handled, tt.want)
+		}
+
+		// The table agrees with the debugger
+		last := make(map[string]signalSetting)
+		for _, setting := range handler.handled {
+			last[setting.Signal] = setting
+		}
+		for signal, want := range last {
+			if got, _ := table.lookup(signal); got != want {
+				t.Errorf("configure(%q) left %v in the table, want %v", tt.spec, got, want)
+			}
+		}
+	}
+}
+
+var configureErrors = []string{
+	"SIGUSR1",
+	"SIGUSR1=",
+	"SIGUSR1=bogus",
+	"SIGUSR1=stop,bogus",
+	"sigusr1=stop",
+	"USR1=stop",
+	"=stop",
+}
+
+func TestConfigureErrors(t *testing.T) {
+	for _, spec := range configureErrors {
+		table := newSignalTable()
+
+		if err := table.configure(&recordingHandler{}, spec); err == nil {
+			t.Errorf("configure(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// buildTest compiles the test binary for the package named by pkg and
+// returns the path of the binary and the package's source directory.
+func (b *builder) buildTest(pkg string) (execPath string, pkgDir string, err error) {
+	pkgDir, err = packageDir(pkg)
+	if err != nil {
+		return "", "", err
+	}
+
+	execPath, err = b.outputPath(filepath.Base(pkgDir) + ".test")
+	if err != nil {
+		return "", "", err
+	}
+
+	args := append([]string{"test", "-c"}, b.buildFlags()...)
+	args = append(args, "-o", execPath, pkg)
+
+	cmd := exec.Command("go", args...)
+	msg, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", "", errors.New(string(msg))
+	}
+
+	return execPath, pkgDir, nil
+}
+
+// parseTestArgs handles the arguments of the test subcommand, which are
+// test flags and an optional package, the first argument before -- that
+// isn't a flag. The returned arguments are the ones to pass to the test
+// binary.
+func parseTestArgs(args []string) (pkg string, list bool, execArgs []string, err error) {
+	testFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+	run := testFlags.String("run", "", "Run only the tests matching this regular expression")
+	verbose := testFlags.Bool("v", false, "Verbose test output")
+	listFlag := testFlags.Bool("list", false, "List the tests in the package and exit")
+
+	// Parsing stops at the package so the flags after it are parsed again
+	for {
+		err = testFlags.Parse(args)
+		if err != nil {
+			return "", false, nil, err
+		}
+
+		rest := testFlags.Args()
+		ended := len(rest) < len(args) && args[len(args)-len(rest)-1] == "--"
+		if pkg != "" || ended || len(rest) == 0 {
+			break
+		}
+
+		pkg = rest[0]
+		args = rest[1:]
+	}
+
+	if pkg == "" {
+		pkg = "."
+	}
+
+	if *run != "" {
+		execArgs = append(execArgs, "-test.run="+*run)
+	}
+	if *verbose {
+		execArgs = append(execArgs, "-test.v")
+	}
+
+	// Anything after the flags is passed along as is
+	execArgs = append(execArgs, testFlags.Args()...)
+
+	return pkg, *listFlag, execArgs, nil
+}
+
+// listTests finds the names of the test functions in the _test.go files
+// of a package directory.
+func listTests(pkgDir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	tests := []string{}
+	fset := token.NewFileSet()
+
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv == nil && isTestFunc(fn) {
+				tests = append(tests, fn.Name.Name)
+			}
+		}
+	}
+
+	sort.Strings(tests)
+	return tests, nil
+}
+
+// isTestFunc checks for the func TestXxx(t *testing.T) signature.
+func isTestFunc(fn *ast.FuncDecl) bool {
+	name := fn.Name.Name
+	if !strings.HasPrefix(name, "Test") || name == "TestMain" {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(name[len("Test"):]); unicode.IsLower(r) {
+		// TestFoo is a test, Testfoo is not
+		return false
+	}
+
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "T"
+}
+
+func addTestHandlers(pkgDir string) {
+	http.HandleFunc("/handle/test/list", wrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tests, err := listTests(pkgDir)
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		resultBytes, err := json.Marshal(map[string]interface{}{"Tests": tests})
+
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+		} else {
+			w.WriteHeader(200)
+			w.Write(resultBytes)
+		}
+	}))
+}
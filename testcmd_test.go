@@ -0,0 +1,108 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+var isTestFuncTests = []struct {
+	decl string
+	want bool
+}{
+	{"func TestFoo(t *testing.T) {}", true},
+	{"func Test(t *testing.T) {}", true},
+	{"func Test_foo(t *testing.T) {}", true},
+	{"func TestÉtat(t *testing.T) {}", true},
+	{"func Testfoo(t *testing.T) {}", false},
+	{"func TestMain(m *testing.M) {}", false},
+	{"func BenchmarkFoo(b *testing.B) {}", false},
+	{"func TestFoo(b *testing.B) {}", false},
+	{"func TestFoo() {}", false},
+	{"func TestFoo(t testing.T) {}", false},
+	{"func TestFoo(t *testing.T, n int) {}", false},
+	{"func TestFoo(t, u *testing.T) {}", false},
+	{"func helper(t *testing.T) {}", false},
+}
+
+func TestIsTestFunc(t *testing.T) {
+	for _, tt := range isTestFuncTests {
+		f, err := parser.ParseFile(token.NewFileSet(), "x_test.go", "package x\n"+tt.decl, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.decl, err)
+		}
+
+		if got := isTestFunc(f.Decls[0].(*ast.FuncDecl)); got != tt.want {
+			t.Errorf("isTestFunc(%s) = %v, want %v", tt.decl, got, tt.want)
+		}
+	}
+}
+
+var parseTestArgsTests = []struct {
+	args     []string
+	pkg      string
+	list     bool
+	execArgs []string
+}{
+	{nil, ".", false, nil},
+	{[]string{"./foo"}, "./foo", false, nil},
+	{[]string{"-v"}, ".", false, []string{"-test.v"}},
+	{[]string{"-list"}, ".", true, nil},
+	{[]string{"pkg", "-run", "^TestA$", "-v"}, "pkg", false, []string{"-test.run=^TestA$", "-test.v"}},
+	// The regular expression reaches the program as is, whatever it holds
+	{[]string{"-run", "Test A|it's"}, ".", false, []string{"-test.run=Test A|it's"}},
+	{[]string{"-run=TestB", "--", "-test.count=2", "x y"}, ".", false,
+		[]string{"-test.run=TestB", "-test.count=2", "x y"}},
+	// The package can come after the flags
+	{[]string{"-v", "./pkg"}, "./pkg", false, []string{"-test.v"}},
+	{[]string{"-run", "TestA", "./pkg", "-list"}, "./pkg", true, []string{"-test.run=TestA"}},
+	{[]string{"-v", "./pkg", "extra"}, "./pkg", false, []string{"-test.v", "extra"}},
+	{[]string{"-v", "--", "./pkg"}, ".", false, []string{"-test.v", "./pkg"}},
+}
+
+func TestParseTestArgs(t *testing.T) {
+	for _, tt := range parseTestArgsTests {
+		pkg, list, execArgs, err := parseTestArgs(tt.args)
+		if err != nil {
+			t.Errorf("parseTestArgs(%q): %v", tt.args, err)
+			continue
+		}
+
+		if pkg != tt.pkg || list != tt.list || !reflect.DeepEqual(execArgs, tt.execArgs) {
+			t.Errorf("parseTestArgs(%q) = %q, %v, %q; want %q, %v, %q",
+				tt.args, pkg, list, execArgs, tt.pkg, tt.list, tt.execArgs)
+		}
+	}
+}
+
+func TestParseTestArgsBadFlag(t *testing.T) {
+	if _, _, _, err := parseTestArgs([]string{"-bogus"}); err == nil {
+		t.Errorf("parseTestArgs(-bogus) succeeded, want an error")
+	}
+}
+
+var shellQuoteTests = []struct {
+	arg  string
+	want string
+}{
+	{"", "''"},
+	{"-test.v", "'-test.v'"},
+	{"-test.run=^TestA$", "'-test.run=^TestA$'"},
+	{"a b", "'a b'"},
+	{"it's", `'it'\''s'`},
+	{"''", `''\'''\'''`},
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, tt := range shellQuoteTests {
+		if got := shellQuote(tt.arg); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
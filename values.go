@@ -0,0 +1,67 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Sizes in bits of the Go integer types. Programs are assumed to be 64 bit.
+var (
+	goIntBits = map[string]int{"int": 64, "int8": 8, "int16": 16, "int32": 32, "int64": 64,
+		"rune": 32}
+	goUintBits = map[string]int{"uint": 64, "uint8": 8, "uint16": 16, "uint32": 32, "uint64": 64,
+		"uintptr": 64, "byte": 8}
+	goFloatBits = map[string]int{"float32": 32, "float64": 64}
+)
+
+// goValue checks that a value makes sense for a Go type before it is
+// given to the debugger, which would otherwise truncate it or give a
+// confusing error. The value comes back in the form that the debugger
+// expects. Values of named and composite types are left to the debugger.
+func goValue(goType string, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", errors.New("Expected a value")
+	}
+
+	switch {
+	case goType == "bool":
+		if value != "true" && value != "false" {
+			return "", errors.New("Expected true or false for a bool")
+		}
+	case goIntBits[goType] != 0:
+		n, err := strconv.ParseInt(value, 0, goIntBits[goType])
+		if err != nil {
+			return "", errors.New(value + " is not a valid " + goType)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case goUintBits[goType] != 0:
+		n, err := strconv.ParseUint(value, 0, goUintBits[goType])
+		if err != nil {
+			return "", errors.New(value + " is not a valid " + goType)
+		}
+		return strconv.FormatUint(n, 10), nil
+	case goFloatBits[goType] != 0:
+		_, err := strconv.ParseFloat(value, goFloatBits[goType])
+		if err != nil {
+			return "", errors.New(value + " is not a valid " + goType)
+		}
+	case goType == "string":
+		// Plain text is quoted for convenience, as is a rune literal
+		if _, err := strconv.Unquote(value); err != nil || value[0] == '\'' {
+			value = strconv.Quote(value)
+		}
+	case strings.HasPrefix(goType, "*"), strings.HasPrefix(goType, "chan "),
+		strings.HasPrefix(goType, "map["), strings.HasPrefix(goType, "func("):
+		if _, err := strconv.ParseUint(value, 0, 64); err != nil && value != "nil" {
+			return "", errors.New("Expected nil or an address for a " + goType)
+		}
+	}
+
+	return value, nil
+}
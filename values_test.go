@@ -0,0 +1,87 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+var goValueTests = []struct {
+	goType string
+	value  string
+	want   string
+	ok     bool
+}{
+	{"bool", "true", "true", true},
+	{"bool", " false ", "false", true},
+	{"bool", "True", "", false},
+	{"bool", "1", "", false},
+	{"int", "", "", false},
+	{"int", "   ", "", false},
+
+	// Integers are checked against their size and given in decimal
+	{"int8", "127", "127", true},
+	{"int8", "-128", "-128", true},
+	{"int8", "128", "", false},
+	{"int8", "0x7f", "127", true},
+	{"int", "0b101", "5", true},
+	{"int", "0o17", "15", true},
+	{"int", "017", "15", true},
+	{"int", "1_000", "1000", true},
+	{"int", "1.5", "", false},
+	{"int", "x", "", false},
+	{"int64", "-9223372036854775808", "-9223372036854775808", true},
+	{"int64", "9223372036854775808", "", false},
+	{"rune", "0x10ffff", "1114111", true},
+	{"uint8", "255", "255", true},
+	{"uint8", "256", "", false},
+	{"uint", "-1", "", false},
+	{"byte", "0xff", "255", true},
+	{"uint64", "18446744073709551615", "18446744073709551615", true},
+	{"uintptr", "0xc000010000", "824633786368", true},
+
+	// Floats are left as they are
+	{"float64", "1.5", "1.5", true},
+	{"float64", "-2e10", "-2e10", true},
+	{"float32", "3.4e38", "3.4e38", true},
+	{"float32", "1e39", "", false},
+	{"float64", "abc", "", false},
+
+	// Strings are quoted unless they already are
+	{"string", "hello", `"hello"`, true},
+	{"string", `"hello"`, `"hello"`, true},
+	{"string", "`raw`", "`raw`", true},
+	{"string", `say "hi"`, `"say \"hi\""`, true},
+	{"string", `"unterminated`, `"\"unterminated"`, true},
+	{"string", `'x'`, `"'x'"`, true},
+	{"string", `""`, `""`, true},
+
+	// Pointers and the like take nil or an address
+	{"*int", "nil", "nil", true},
+	{"*main.T", "0xc000010000", "0xc000010000", true},
+	{"*int", "&x", "", false},
+	{"map[string]int", "nil", "nil", true},
+	{"chan int", "0", "0", true},
+	{"func()", "main.f", "", false},
+
+	// Anything else is up to the debugger
+	{"main.T", "{1, 2}", "{1, 2}", true},
+	{"[]int", "nil", "nil", true},
+}
+
+func TestGoValue(t *testing.T) {
+	for _, tt := range goValueTests {
+		got, err := goValue(tt.goType, tt.value)
+
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("goValue(%s, %q): %v", tt.goType, tt.value, err)
+		case !tt.ok && err == nil:
+			t.Errorf("goValue(%s, %q) = %q, want an error", tt.goType, tt.value, got)
+		case got != tt.want:
+			t.Errorf("goValue(%s, %q) = %q, want %q", tt.goType, tt.value, got, tt.want)
+		}
+	}
+}
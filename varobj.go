@@ -0,0 +1,516 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// Children listed at a time unless the client asks for some other amount
+	childrenPageSize = 100
+	// Most children listed for one request at all depths together so that
+	//  the pretty printers aren't asked to walk a huge slice or map
+	maxChildrenListed = 1000
+	// Most levels of children listed for one request
+	maxChildrenDepth = 8
+)
+
+// varobjFormats are the formats that the value of a variable object can
+// be shown in by the names that clients give them. Raw is the natural
+// format without the pretty printers, showing the len, cap and data
+// pointer of slices and strings for example.
+var varobjFormats = map[string]string{
+	"natural": "natural", "raw": "natural",
+	"hex": "hexadecimal", "hexadecimal": "hexadecimal", "zero-hexadecimal": "zero-hexadecimal",
+	"binary": "binary", "octal": "octal", "decimal": "decimal",
+}
+
+// varobjChange is sent to the web clients for each variable object that
+// changed when the program stopped. Those no longer in scope are deleted.
+type varobjChange struct {
+	Name    string
+	Value   string
+	InScope bool
+}
+
+type registeredVarobj struct {
+	frame      string
+	expression string
+	result     map[string]interface{}
+}
+
+// varobjRegistry owns the variable objects that clients create. Asking
+// for the same expression in the same frame gives back the variable
+// object from before rather than a new one so that they don't pile up in
+// the debugger over a long session. Since they are shared by all of the
+// clients they are only deleted once they go out of scope. They are
+// updated each time the program stops.
+type varobjRegistry struct {
+	mygdb Debugger
+	hub   *broadcaster
+
+	// Held while talking to the debugger so that lookups always see the
+	//  variable objects as of the last stop
+	updating sync.Mutex
+
+	mutex   sync.Mutex
+	varobjs map[string]*registeredVarobj
+	// Set from the time the program stops until the update
+	stale bool
+	// Variable objects, children included, that changed at the last stop
+	changed map[string]bool
+	// Formats of the variable objects that aren't natural
+	formats map[string]string
+	// Variable objects, children included, whose children come from a
+	//  pretty printer
+	dynamic map[string]bool
+}
+
+func newVarobjRegistry(mygdb Debugger, hub *broadcaster) *varobjRegistry {
+	return &varobjRegistry{mygdb: mygdb, hub: hub, varobjs: make(map[string]*registeredVarobj),
+		changed: make(map[string]bool), formats: make(map[string]string), dynamic: make(map[string]bool)}
+}
+
+// stopped updates the variable objects after the program stops. It is
+// called from the pump so the update itself happens elsewhere.
+func (r *varobjRegistry) stopped(record gdblib.AsyncResultRecord) {
+	if record.Indication != "stopped" {
+		return
+	}
+
+	r.mutex.Lock()
+	r.stale = true
+	r.mutex.Unlock()
+
+	go func() {
+		r.updating.Lock()
+		defer r.updating.Unlock()
+
+		r.update()
+	}()
+}
+
+// update must be called with updating held.
+func (r *varobjRegistry) update() {
+	r.mutex.Lock()
+	stale := r.stale
+	r.stale = false
+	r.mutex.Unlock()
+
+	if !stale {
+		return
+	}
+
+	r.refresh(true, []varobjChange{})
+}
+
+// refresh brings the values of the variable objects up to date and sends
+// the changes to the clients along with the ones given. They replace the
+// changes from the last stop if the program has stopped since, otherwise
+// they are added to them. It must be called with updating held.
+func (r *varobjRegistry) refresh(stopped bool, changes []varobjChange) {
+	// The changes given are still sent if the others can't be found
+	update := miVarUpdate{}
+	result, err := r.mygdb.VarUpdate(gdblib.VarUpdateParms{Name: "*", AllValues: true})
+	if err == nil {
+		remarshal(result, &update)
+	}
+
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		changed[change.Name] = true
+	}
+
+	for _, change := range update.Changelist {
+		inScope := change.InScope != "false" && change.InScope != "invalid"
+
+		r.mutex.Lock()
+		varobj := r.varobjs[change.Name]
+		if varobj != nil && inScope {
+			varobj.result["value"] = change.Value
+		} else if varobj != nil {
+			r.forget(change.Name)
+		}
+		r.mutex.Unlock()
+
+		if inScope {
+			changed[change.Name] = true
+		} else if varobj != nil {
+			r.mygdb.VarDelete(gdblib.VarDeleteParms{Name: change.Name})
+		}
+
+		changes = append(changes, varobjChange{Name: change.Name, Value: change.Value, InScope: inScope})
+	}
+
+	r.mutex.Lock()
+	if stopped {
+		r.changed = changed
+	} else {
+		for name := range changed {
+			r.changed[name] = true
+		}
+	}
+	r.mutex.Unlock()
+
+	if len(changes) > 0 {
+		r.hub.publish(webSockResult{Type: "varobj-update", Data: changes})
+	}
+}
+
+// currentFrame identifies the selected frame well enough to tell whether
+// a variable object was created in it.
+func (r *varobjRegistry) currentFrame() (string, error) {
+	result, err := r.mygdb.ThreadListIds()
+	if err != nil {
+		return "", err
+	}
+
+	threads := struct {
+		Current string `json:"current-thread-id"`
+	}{}
+	remarshal(result, &threads)
+
+	result, err = r.mygdb.StackInfoFrame()
+	if err != nil {
+		return "", err
+	}
+
+	info := miFrameInfo{}
+	remarshal(result, &info)
+
+	return threads.Current + "/" + info.Frame.Level + "/" + info.Frame.Func, nil
+}
+
+// create gives the variable object for an expression in the selected
+// frame, creating it if need be, in a format unless it is empty. The
+// result is flagged if the value changed at the last stop.
+func (r *varobjRegistry) create(expression string, format string) (interface{}, error) {
+	r.updating.Lock()
+	defer r.updating.Unlock()
+
+	r.update()
+
+	varobj, name, err := r.lookup(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if format != "" {
+		_, err = r.applyFormat(name, format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	result := map[string]interface{}{"changed": r.changed[name], "format": r.format(name)}
+	for key, value := range varobj.result {
+		result[key] = value
+	}
+	return result, nil
+}
+
+// lookup gives the variable object for an expression in the selected
+// frame, creating it if need be. It must be called with updating held.
+func (r *varobjRegistry) lookup(expression string) (*registeredVarobj, string, error) {
+	frame, err := r.currentFrame()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var varobj *registeredVarobj
+
+	r.mutex.Lock()
+	for _, existing := range r.varobjs {
+		if existing.frame == frame && existing.expression == expression {
+			varobj = existing
+		}
+	}
+	r.mutex.Unlock()
+
+	if varobj == nil {
+		created, err := r.mygdb.VarCreate(gdblib.VarCreateParms{Expression: expression})
+		if err != nil {
+			return nil, "", err
+		}
+
+		varobj = &registeredVarobj{frame: frame, expression: expression, result: map[string]interface{}{}}
+		remarshal(created, &varobj.result)
+	}
+
+	name, _ := varobj.result["name"].(string)
+
+	r.mutex.Lock()
+	r.varobjs[name] = varobj
+	r.dynamic[name] = varobj.result["dynamic"] == "1"
+	r.mutex.Unlock()
+
+	return varobj, name, nil
+}
+
+// assign gives a new value, written as the client would in Go, to a
+// variable object or to an expression in the selected frame. All of the
+// clients are told of the new value along with anything else that it
+// changed.
+func (r *varobjRegistry) assign(name string, expression string, value string) (interface{}, error) {
+	r.updating.Lock()
+	defer r.updating.Unlock()
+
+	r.update()
+
+	if name == "" {
+		var err error
+		_, name, err = r.lookup(expression)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := r.mygdb.VarInfoType(gdblib.VarInfoTypeParms{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	varType := miVarType{}
+	remarshal(result, &varType)
+
+	value, err = goValue(varType.Type, value)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = r.mygdb.VarAssign(gdblib.VarAssignParms{Name: name, Expression: value})
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := miVarFormat{}
+	remarshal(result, &assigned)
+
+	r.mutex.Lock()
+	if varobj := r.varobjs[name]; varobj != nil {
+		varobj.result["value"] = assigned.Value
+	}
+	r.mutex.Unlock()
+
+	r.refresh(false, []varobjChange{{Name: name, Value: assigned.Value, InScope: true}})
+
+	return result, nil
+}
+
+// setFormat changes the format of a variable object and gives its value
+// in the new format.
+func (r *varobjRegistry) setFormat(name string, format string) (*miVarFormat, error) {
+	r.updating.Lock()
+	defer r.updating.Unlock()
+
+	return r.applyFormat(name, format)
+}
+
+// applyFormat must be called with updating held.
+func (r *varobjRegistry) applyFormat(name string, format string) (*miVarFormat, error) {
+	spec, ok := varobjFormats[format]
+	if !ok {
+		return nil, errors.New("Unknown format: " + format)
+	}
+
+	r.mutex.Lock()
+	raw := r.formats[name] == "raw"
+	r.mutex.Unlock()
+
+	var err error
+	switch {
+	case format == "raw":
+		err = r.mygdb.VarSetVisualizer(gdblib.VarSetVisualizerParms{Name: name, Visualizer: "None"})
+	case raw:
+		err = r.mygdb.VarSetVisualizer(gdblib.VarSetVisualizerParms{Name: name, Visualizer: "gdb.default_visualizer"})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Setting the format gives the value in it
+	result, err := r.mygdb.VarSetFormat(gdblib.VarSetFormatParms{Name: name, FormatSpec: spec})
+	if err != nil {
+		return nil, err
+	}
+
+	formatted := &miVarFormat{}
+	remarshal(result, formatted)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if format == "natural" {
+		delete(r.formats, name)
+	} else {
+		r.formats[name] = format
+	}
+	if varobj := r.varobjs[name]; varobj != nil {
+		varobj.result["value"] = formatted.Value
+	}
+
+	return formatted, nil
+}
+
+// listChildren lists a page of the children of a variable object with
+// the ones that changed at the last stop flagged. Children are listed
+// depth levels down, each under its parent, until maxChildrenListed have
+// been listed in all. The children are put in a format unless it is
+// empty.
+func (r *varobjRegistry) listChildren(parms gdblib.VarListChildrenParms, format string, depth int) (interface{}, error) {
+	r.updating.Lock()
+	defer r.updating.Unlock()
+
+	r.update()
+
+	budget := maxChildrenListed
+	return r.listLevel(parms, format, depth, &budget)
+}
+
+// listLevel must be called with updating held.
+func (r *varobjRegistry) listLevel(parms gdblib.VarListChildrenParms, format string, depth int, budget *int) (map[string]interface{}, error) {
+	if parms.To <= parms.From {
+		parms.To = parms.From + childrenPageSize
+	}
+	if parms.To-parms.From > *budget {
+		parms.To = parms.From + *budget
+	}
+
+	result, err := r.mygdb.VarListChildren(parms)
+	if err != nil {
+		return nil, err
+	}
+
+	children := map[string]interface{}{}
+	if err = remarshal(result, &children); err != nil {
+		return nil, err
+	}
+
+	// Pretty printed children are only counted as far as they have been
+	//  listed so there is no total for them, gdb says if there are more.
+	//  The raw format turns the pretty printer off.
+	r.mutex.Lock()
+	dynamic := r.dynamic[parms.Name] && r.formats[parms.Name] != "raw"
+	r.mutex.Unlock()
+
+	if dynamic {
+		hasMore, _ := children["has_more"].(string)
+		children["has_more"] = hasMore != "" && hasMore != "0"
+	} else {
+		result, err = r.mygdb.VarInfoNumChildren(gdblib.VarInfoNumChildrenParms{Name: parms.Name})
+		if err != nil {
+			return nil, err
+		}
+		count := miChildren{}
+		remarshal(result, &count)
+
+		total, _ := strconv.Atoi(count.Numchild)
+		children["has_more"] = total > parms.To
+		children["total"] = total
+	}
+	children["from"] = parms.From
+
+	list, _ := children["children"].([]interface{})
+	*budget -= len(list)
+
+	for _, child := range list {
+		child, ok := child.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := child["name"].(string)
+
+		if format != "" {
+			formatted, err := r.applyFormat(name, format)
+			if err != nil {
+				return nil, err
+			}
+			child["value"] = formatted.Value
+		}
+
+		numchild, _ := child["numchild"].(string)
+		dynamic, _ := child["dynamic"].(string)
+
+		r.mutex.Lock()
+		child["changed"] = r.changed[name]
+		child["format"] = r.format(name)
+		r.dynamic[name] = dynamic == "1"
+		r.mutex.Unlock()
+
+		if depth <= 1 || *budget <= 0 || ((numchild == "" || numchild == "0") && dynamic != "1") {
+			continue
+		}
+
+		grandchildren, err := r.listLevel(gdblib.VarListChildrenParms{Name: name, AllValues: parms.AllValues},
+			format, depth-1, budget)
+		if err != nil {
+			return nil, err
+		}
+		child["children"] = grandchildren
+	}
+
+	return children, nil
+}
+
+// format must be called with the mutex held.
+func (r *varobjRegistry) format(name string) string {
+	if format, ok := r.formats[name]; ok {
+		return format
+	}
+	return "natural"
+}
+
+// owns reports whether a variable object, or the parent of a child, is
+// one of the registry's.
+func (r *varobjRegistry) owns(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for {
+		if r.varobjs[name] != nil {
+			return true
+		}
+
+		dot := strings.LastIndex(name, ".")
+		if dot == -1 {
+			return false
+		}
+		name = name[:dot]
+	}
+}
+
+// remove forgets a variable object that a client created for itself and
+// then deleted.
+func (r *varobjRegistry) remove(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.forget(name)
+}
+
+// forget must be called with the mutex held. What is known about the
+// children goes along with the variable object.
+func (r *varobjRegistry) forget(name string) {
+	delete(r.varobjs, name)
+
+	for child := range r.formats {
+		if child == name || strings.HasPrefix(child, name+".") {
+			delete(r.formats, child)
+		}
+	}
+	for child := range r.dynamic {
+		if child == name || strings.HasPrefix(child, name+".") {
+			delete(r.dynamic, child)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2013 Chris McGee <sirnewton_01@yahoo.ca>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"github.com/sirnewton01/godbg/gdblib"
+	"strings"
+)
+
+// watchpointEvent is sent to the web clients whenever a watchpoint
+// triggers so that they don't have to dig through the stop record.
+type watchpointEvent struct {
+	Number     string
+	Expression string
+	// One of write, read or access
+	Kind     string
+	Old      string `json:",omitempty"`
+	New      string `json:",omitempty"`
+	Value    string `json:",omitempty"`
+	ThreadId string
+	Frame    miFrame
+}
+
+type miWatchpointStop struct {
+	miStop
+	miBreakWatch
+	Value struct {
+		Old   string `json:"old"`
+		New   string `json:"new"`
+		Value string `json:"value"`
+	} `json:"value"`
+}
+
+var watchpointKinds = map[string]string{
+	"watchpoint-trigger":        "write",
+	"read-watchpoint-trigger":   "read",
+	"access-watchpoint-trigger": "access",
+}
+
+// watchpointTrigger picks apart the stop record of a watchpoint.
+func watchpointTrigger(record gdblib.AsyncResultRecord) (*watchpointEvent, bool) {
+	if record.Indication != "stopped" {
+		return nil, false
+	}
+
+	stop := miWatchpointStop{}
+	err := remarshal(record.Result, &stop)
+	if err != nil {
+		return nil, false
+	}
+
+	kind, ok := watchpointKinds[stop.Reason]
+	wpt := stop.watchpoint()
+	if !ok || wpt == nil {
+		return nil, false
+	}
+
+	return &watchpointEvent{Number: wpt.Number, Expression: wpt.Exp, Kind: kind,
+		Old: stop.Value.Old, New: stop.Value.New, Value: stop.Value.Value,
+		ThreadId: stop.ThreadId, Frame: stop.Frame}, true
+}
+
+// watchExpression turns an address such as &s.field into the memory
+// that it points to for gdb. Watching the memory rather than the
+// expression means that the watchpoint isn't deleted once the frame
+// holding s goes out of scope, which is what's wanted for heap values
+// shared between goroutines.
+func (d gdbDebugger) watchExpression(expression string) (string, error) {
+	expression = strings.TrimSpace(expression)
+	if !strings.HasPrefix(expression, "&") {
+		return expression, nil
+	}
+
+	result, err := d.VarCreate(gdblib.VarCreateParms{Expression: expression})
+	if err != nil {
+		return "", err
+	}
+
+	address := miVariable{}
+	err = remarshal(result, &address)
+	d.VarDelete(gdblib.VarDeleteParms{Name: address.Name})
+	if err != nil {
+		return "", err
+	}
+
+	// Pointer values may be prefixed with their type, (int *) 0xc000010000
+	fields := strings.Fields(address.Value)
+	if len(fields) == 0 || !strings.HasPrefix(fields[len(fields)-1], "0x") {
+		return "", errors.New(expression + " is not an address")
+	}
+
+	return "*(" + address.Type + ")(" + fields[len(fields)-1] + ")", nil
+}